@@ -0,0 +1,206 @@
+package broadcast
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/qjpcpu/common/json"
+	"github.com/qjpcpu/common/redisutil"
+)
+
+// bridgeMessage value on the wire, origin is id of the sending bridge
+type bridgeMessage struct {
+	Origin string          `json:"origin"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// bridgeTransport message bus between processes
+type bridgeTransport interface {
+	publish(data []byte) error
+	// subscribe deliver messages to fn until stopC is closed or connection fails
+	subscribe(stopC <-chan struct{}, fn func([]byte)) error
+}
+
+// Bridge forward values of a local broadcaster to other processes, and send values from other processes
+// to the local broadcaster; values are json encoded and a bridge never receives values sent by itself
+type Bridge struct {
+	b         *Broadcaster
+	transport bridgeTransport
+	origin    string
+	sub       *Subscription
+	stopC     chan struct{}
+	wg        *sync.WaitGroup
+	once      *sync.Once
+	*sync.Mutex
+}
+
+// NewRedisBridge bridge broadcaster over redis pub/sub channel
+func NewRedisBridge(b *Broadcaster, pool *redisutil.Pool, channel string) *Bridge {
+	return newBridge(b, &redisTransport{pool: pool, channel: channel})
+}
+
+func newBridge(b *Broadcaster, transport bridgeTransport) *Bridge {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return &Bridge{
+		b:         b,
+		transport: transport,
+		origin:    hex.EncodeToString(buf),
+		stopC:     make(chan struct{}),
+		wg:        new(sync.WaitGroup),
+		once:      new(sync.Once),
+		Mutex:     new(sync.Mutex),
+	}
+}
+
+// Origin id of bridge
+func (br *Bridge) Origin() string {
+	return br.origin
+}
+
+// Start start forwarding
+func (br *Bridge) Start() error {
+	br.Lock()
+	defer br.Unlock()
+	if br.sub != nil {
+		return errors.New("bridge already started")
+	}
+	select {
+	case <-br.stopC:
+		return errors.New("bridge stopped")
+	default:
+	}
+	localC := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, br.b.valueType), 0)
+	sub, err := br.b.Subscribe(localC.Interface(), WithBuffer(1024, DropOldest))
+	if err != nil {
+		return err
+	}
+	br.sub = sub
+	br.wg.Add(2)
+	go br.forward(localC)
+	go br.receive()
+	return nil
+}
+
+// Stop stop forwarding
+func (br *Bridge) Stop() {
+	br.once.Do(func() {
+		br.Lock()
+		close(br.stopC)
+		sub := br.sub
+		br.Unlock()
+		if sub != nil {
+			sub.Close()
+		}
+	})
+	br.wg.Wait()
+}
+
+// forward local values to transport
+func (br *Bridge) forward(localC reflect.Value) {
+	defer br.wg.Done()
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: localC},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(br.stopC)},
+	}
+	for {
+		chosen, v, _ := reflect.Select(cases)
+		if chosen == 1 {
+			return
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			log.Printf("[broadcast]encode %v fail:%v", v.Interface(), err)
+			continue
+		}
+		msg, _ := json.Marshal(bridgeMessage{Origin: br.origin, Data: data})
+		if err := br.transport.publish(msg); err != nil {
+			log.Printf("[broadcast]publish fail:%v", err)
+		}
+	}
+}
+
+// receive values of other bridges and send them to local broadcaster
+func (br *Bridge) receive() {
+	defer br.wg.Done()
+	for {
+		err := br.transport.subscribe(br.stopC, br.onMessage)
+		select {
+		case <-br.stopC:
+			return
+		default:
+		}
+		log.Printf("[broadcast]subscribe fail:%v", err)
+		select {
+		case <-br.stopC:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (br *Bridge) onMessage(data []byte) {
+	var msg bridgeMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Origin == br.origin {
+		return
+	}
+	v := reflect.New(br.b.valueType)
+	if err := json.Unmarshal(msg.Data, v.Interface()); err != nil {
+		log.Printf("[broadcast]decode %s fail:%v", string(msg.Data), err)
+		return
+	}
+	// skip own subscription, so the value is not forwarded back
+	br.b.send(skipEnvelope{v: v.Elem().Interface(), skip: br.sub})
+}
+
+type redisTransport struct {
+	pool    *redisutil.Pool
+	channel string
+}
+
+func (t *redisTransport) publish(data []byte) error {
+	conn := t.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("PUBLISH", t.channel, data)
+	return err
+}
+
+func (t *redisTransport) subscribe(stopC <-chan struct{}, fn func([]byte)) error {
+	conn := redis.PubSubConn{Conn: t.pool.Get()}
+	defer conn.Close()
+	if err := conn.Subscribe(t.channel); err != nil {
+		return err
+	}
+	doneC, exitC := make(chan struct{}), make(chan struct{})
+	// conn is written by Unsubscribe, wait it before Close
+	defer func() {
+		close(doneC)
+		<-exitC
+	}()
+	go func() {
+		defer close(exitC)
+		select {
+		case <-stopC:
+			conn.Unsubscribe()
+		case <-doneC:
+		}
+	}()
+	for {
+		switch m := conn.ReceiveWithTimeout(0).(type) {
+		case redis.Message:
+			fn(m.Data)
+		case redis.Subscription:
+			if m.Count == 0 {
+				return nil
+			}
+		case error:
+			return m
+		}
+	}
+}
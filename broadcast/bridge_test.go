@@ -0,0 +1,281 @@
+package broadcast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qjpcpu/common/redisutil"
+)
+
+// memBus in-memory pub/sub shared by bridges
+type memBus struct {
+	subs []chan []byte
+	*sync.Mutex
+}
+
+func (m *memBus) publish(data []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, c := range m.subs {
+		c <- data
+	}
+	return nil
+}
+
+func (m *memBus) subscribe(stopC <-chan struct{}, fn func([]byte)) error {
+	c := make(chan []byte, 100)
+	m.Lock()
+	m.subs = append(m.subs, c)
+	m.Unlock()
+	for {
+		select {
+		case data := <-c:
+			fn(data)
+		case <-stopC:
+			return nil
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	type Invalidate struct {
+		Key string
+	}
+	bus := &memBus{Mutex: new(sync.Mutex)}
+	b1, b2 := New(Invalidate{}), New(Invalidate{})
+	br1, br2 := newBridge(b1, bus), newBridge(b2, bus)
+	if err := br1.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := br2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if br1.Start() == nil {
+		t.Fatal("should not start twice")
+	}
+	c1, c2 := make(chan Invalidate, 10), make(chan Invalidate, 10)
+	b1.Notify(c1)
+	b2.Notify(c2)
+	waitFor(t, func() bool {
+		bus.Lock()
+		defer bus.Unlock()
+		return len(bus.subs) == 2
+	})
+
+	b1.Send(Invalidate{Key: "a"})
+	b2.Send(Invalidate{Key: "b"})
+	got := func(c chan Invalidate) map[string]bool {
+		keys := make(map[string]bool)
+		for i := 0; i < 2; i++ {
+			select {
+			case v := <-c:
+				keys[v.Key] = true
+			case <-time.After(time.Second):
+				t.Fatal("timeout")
+			}
+		}
+		// no echo of values received from the other side
+		select {
+		case v := <-c:
+			t.Fatalf("unexpected %+v", v)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return keys
+	}
+	for _, c := range []chan Invalidate{c1, c2} {
+		if keys := got(c); !keys["a"] || !keys["b"] {
+			t.Fatalf("got %v", keys)
+		}
+	}
+	br1.Stop()
+	br2.Stop()
+	b1.Stop()
+	b2.Stop()
+}
+
+// pubsubServer minimal redis server of PUBLISH/SUBSCRIBE, without patterns, miniredis v2.5.0 doesn't support pub/sub
+type pubsubServer struct {
+	ln   net.Listener
+	subs map[string]map[*respConn]bool
+	*sync.Mutex
+}
+
+type respConn struct {
+	net.Conn
+	*sync.Mutex
+}
+
+func (c *respConn) write(format string, args ...interface{}) {
+	c.Lock()
+	fmt.Fprintf(c.Conn, format, args...)
+	c.Unlock()
+}
+
+func startPubsubServer(t *testing.T) *pubsubServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &pubsubServer{ln: ln, subs: make(map[string]map[*respConn]bool), Mutex: new(sync.Mutex)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(&respConn{Conn: conn, Mutex: new(sync.Mutex)})
+		}
+	}()
+	return srv
+}
+
+func (srv *pubsubServer) subscribers(channel string) int {
+	srv.Lock()
+	defer srv.Unlock()
+	return len(srv.subs[channel])
+}
+
+func (srv *pubsubServer) serve(conn *respConn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	var channels []string
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			srv.Lock()
+			for _, ch := range channels {
+				delete(srv.subs[ch], conn)
+			}
+			srv.Unlock()
+			return
+		}
+		switch args[0] {
+		case "SUBSCRIBE":
+			for _, ch := range args[1:] {
+				srv.Lock()
+				if srv.subs[ch] == nil {
+					srv.subs[ch] = make(map[*respConn]bool)
+				}
+				srv.subs[ch][conn] = true
+				srv.Unlock()
+				channels = append(channels, ch)
+				conn.write("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(ch), ch, len(channels))
+			}
+		case "UNSUBSCRIBE":
+			if len(channels) == 0 {
+				conn.write("*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
+			}
+			for len(channels) > 0 {
+				ch := channels[0]
+				channels = channels[1:]
+				srv.Lock()
+				delete(srv.subs[ch], conn)
+				srv.Unlock()
+				conn.write("*3\r\n$11\r\nunsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(ch), ch, len(channels))
+			}
+		case "PUNSUBSCRIBE":
+			conn.write("*3\r\n$12\r\npunsubscribe\r\n$-1\r\n:%d\r\n", len(channels))
+		case "PUBLISH":
+			ch, msg := args[1], args[2]
+			srv.Lock()
+			var list []*respConn
+			for c := range srv.subs[ch] {
+				list = append(list, c)
+			}
+			srv.Unlock()
+			for _, c := range list {
+				c.write("*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(ch), ch, len(msg), msg)
+			}
+			conn.write(":%d\r\n", len(list))
+		case "ECHO":
+			conn.write("$%d\r\n%s\r\n", len(args[1]), args[1])
+		default:
+			conn.write("+OK\r\n")
+		}
+	}
+}
+
+// readCommand read command sent as array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil || line[0] != '*' || n < 1 {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(line[1 : len(line)-2])
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestBridgeStartStop(t *testing.T) {
+	bus := &memBus{Mutex: new(sync.Mutex)}
+	b := New("")
+	defer b.Stop()
+	br := newBridge(b, bus)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		br.Start()
+	}()
+	br.Stop()
+	<-done
+	if br.Start() == nil {
+		t.Fatal("should not start after Stop")
+	}
+	// subscription made by the racing Start is closed by Stop or never made
+	waitFor(t, func() bool { return len(b.Stats()) == 0 })
+}
+
+func TestRedisBridge(t *testing.T) {
+	type Invalidate struct {
+		Key string
+	}
+	srv := startPubsubServer(t)
+	defer srv.ln.Close()
+	pool := redisutil.CreatePool(srv.ln.Addr().String(), "", "")
+	b1, b2 := New(Invalidate{}), New(Invalidate{})
+	br1, br2 := NewRedisBridge(b1, pool, "invalidate"), NewRedisBridge(b2, pool, "invalidate")
+	br1.Start()
+	br2.Start()
+	waitFor(t, func() bool { return srv.subscribers("invalidate") == 2 })
+	c1, c2 := make(chan Invalidate, 10), make(chan Invalidate, 10)
+	b1.Notify(c1)
+	b2.Notify(c2)
+	b1.Send(Invalidate{Key: "a"})
+	for _, c := range []chan Invalidate{c1, c2} {
+		select {
+		case v := <-c:
+			if v.Key != "a" {
+				t.Fatalf("got %+v", v)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	br1.Stop()
+	br2.Stop()
+	if n := srv.subscribers("invalidate"); n != 0 {
+		t.Fatalf("bridges should unsubscribe on Stop, %d left", n)
+	}
+	b1.Stop()
+	b2.Stop()
+}
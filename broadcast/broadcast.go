@@ -3,84 +3,228 @@ package broadcast
 import (
 	"errors"
 	"reflect"
+	"sync"
 )
 
-type broadcast struct {
-	c chan broadcast
-	v interface{}
-}
+// ErrStopped broadcaster or hub is stopped
+var ErrStopped = errors.New("broadcaster stopped")
 
 // Broadcaster notifier
 type Broadcaster struct {
-	// private fields:
-	listenc   chan chan (chan broadcast)
-	Sendc     chan<- interface{}
+	sendc     chan interface{}
 	valueType reflect.Type
+	subs      map[*Subscription]bool
+	history   []interface{}
+	keep      int
+	stopped   bool
+	stopC     chan struct{}
+	once      *sync.Once
+	*sync.RWMutex
 }
 
 // New create a new broadcaster object.
 func New(meta interface{}) *Broadcaster {
-	listenc := make(chan (chan (chan broadcast)))
-	sendc := make(chan interface{})
-	go func() {
-		currc := make(chan broadcast, 1)
-		for {
-			select {
-			case v, ok := <-sendc:
-				if !ok {
-					return
-				}
-				c := make(chan broadcast, 1)
-				b := broadcast{c: c, v: v}
-				currc <- b
-				currc = c
-			case r := <-listenc:
-				r <- currc
+	b := &Broadcaster{
+		sendc:     make(chan interface{}),
+		valueType: reflect.TypeOf(meta),
+		subs:      make(map[*Subscription]bool),
+		keep:      1,
+		stopC:     make(chan struct{}),
+		once:      new(sync.Once),
+		RWMutex:   new(sync.RWMutex),
+	}
+	go b.loop()
+	return b
+}
+
+// skipEnvelope value which is not delivered to skip subscription
+type skipEnvelope struct {
+	v    interface{}
+	skip *Subscription
+}
+
+func (b *Broadcaster) loop() {
+	for {
+		var v interface{}
+		select {
+		case v = <-b.sendc:
+		case <-b.stopC:
+			b.closeAll()
+			return
+		}
+		var skip *Subscription
+		if env, ok := v.(skipEnvelope); ok {
+			v, skip = env.v, env.skip
+		}
+		// record history and snapshot subscribers together, so a new subscriber gets a value either by replay or by delivery
+		b.Lock()
+		b.record(v)
+		subs := make([]*Subscription, 0, len(b.subs))
+		for s := range b.subs {
+			subs = append(subs, s)
+		}
+		b.Unlock()
+		for _, s := range subs {
+			if s != skip && s.accept("", v) {
+				s.offer(v)
 			}
 		}
-	}()
-	return &Broadcaster{
-		listenc:   listenc,
-		Sendc:     sendc,
-		valueType: reflect.TypeOf(meta),
 	}
 }
 
-// Notify start listening to the broadcasts.
+func (b *Broadcaster) closeAll() {
+	b.Lock()
+	b.stopped = true
+	subs := b.subs
+	b.subs = make(map[*Subscription]bool)
+	b.Unlock()
+	for s := range subs {
+		s.close()
+	}
+}
+
+func (b *Broadcaster) record(v interface{}) {
+	if b.keep <= 0 {
+		return
+	}
+	if len(b.history) >= b.keep {
+		b.history = append(b.history[:0], b.history[len(b.history)-b.keep+1:]...)
+	}
+	b.history = append(b.history, v)
+}
+
+// Keep keep last n values for replay, default 1; n <= 0 disables replay
+func (b *Broadcaster) Keep(n int) *Broadcaster {
+	b.Lock()
+	defer b.Unlock()
+	b.keep = n
+	if n <= 0 {
+		b.history = nil
+	} else if len(b.history) > n {
+		b.history = append([]interface{}(nil), b.history[len(b.history)-n:]...)
+	}
+	return b
+}
+
+// Latest the latest value sent, ok is false if nothing is kept
+func (b *Broadcaster) Latest() (v interface{}, ok bool) {
+	b.RLock()
+	defer b.RUnlock()
+	if len(b.history) == 0 {
+		return nil, false
+	}
+	return b.history[len(b.history)-1], true
+}
+
+// Notify start listening to the broadcasts, values are never dropped and Send is never blocked,
+// they are buffered without limit if typpedChan is not drained in time.
 func (b *Broadcaster) Notify(typpedChan interface{}) error {
+	_, err := b.Subscribe(typpedChan, WithUnbounded())
+	return err
+}
+
+// NotifyLossy start listening to the broadcasts without blocking Send, at most 128 values are buffered
+// and the oldest is dropped if typpedChan is not drained in time.
+func (b *Broadcaster) NotifyLossy(typpedChan interface{}) error {
+	_, err := b.Subscribe(typpedChan, WithBuffer(128, DropOldest))
+	return err
+}
+
+// Subscribe start listening to the broadcasts by typpedChan, values are buffered per subscription
+// and handled by buffer policy when typpedChan is not drained in time, default is 128 values and Block.
+// With WithReplay or WithLatest kept values are delivered first.
+func (b *Broadcaster) Subscribe(typpedChan interface{}, opts ...SubOption) (*Subscription, error) {
+	if err := checkChan(typpedChan); err != nil {
+		return nil, err
+	}
+	if reflect.TypeOf(typpedChan).Elem() != b.valueType {
+		return nil, errors.New("bad channel value type")
+	}
+	s := newSubscription(b.remove, reflect.ValueOf(typpedChan), newSubOptions(opts))
+	b.Lock()
+	if b.stopped {
+		b.Unlock()
+		return nil, ErrStopped
+	}
+	b.subs[s] = true
+	if n := s.opt.replay; n > 0 {
+		if n > len(b.history) {
+			n = len(b.history)
+		}
+		s.preload(b.history[len(b.history)-n:])
+	}
+	b.Unlock()
+	go s.pump()
+	return s, nil
+}
+
+func checkChan(typpedChan interface{}) error {
 	tp := reflect.TypeOf(typpedChan)
-	outC := reflect.ValueOf(typpedChan)
-	if tp.Kind() != reflect.Chan {
+	if tp == nil || tp.Kind() != reflect.Chan {
 		return errors.New("input parameter should be channel")
 	}
 	if tp.ChanDir() == reflect.RecvDir {
 		return errors.New("channel should be writable")
 	}
-	if tp.Elem() != b.valueType {
-		return errors.New("bad channel value type")
-	}
-	c := make(chan chan broadcast)
-	b.listenc <- c
-	rc := <-c
-	go func() {
-		defer func() {
-			_ = recover()
-		}()
-		for {
-			b := <-rc
-			v := b.v
-			rc <- b
-			rc = b.c
-			outC.Send(reflect.ValueOf(v))
-		}
-	}()
 	return nil
 }
 
-// Send broadcast a value to all listeners.
-func (b *Broadcaster) Send(v interface{}) { b.Sendc <- v }
+func newSubOptions(opts []SubOption) subOptions {
+	opt := subOptions{size: 128, policy: Block}
+	for _, fn := range opts {
+		fn(&opt)
+	}
+	return opt
+}
+
+// Unsubscribe stop delivering values to subscription
+func (b *Broadcaster) Unsubscribe(s *Subscription) {
+	s.Close()
+}
+
+// Stats stats of all subscriptions
+func (b *Broadcaster) Stats() []SubStats {
+	b.RLock()
+	defer b.RUnlock()
+	list := make([]SubStats, 0, len(b.subs))
+	for s := range b.subs {
+		list = append(list, s.Stats())
+	}
+	return list
+}
+
+func (b *Broadcaster) remove(s *Subscription) {
+	b.Lock()
+	delete(b.subs, s)
+	b.Unlock()
+}
+
+// Send broadcast a value to all listeners, return ErrStopped if Stop has been called; it is the only way to send values.
+func (b *Broadcaster) Send(v interface{}) error {
+	if !b.send(v) {
+		return ErrStopped
+	}
+	return nil
+}
+
+// send report false if broadcaster is stopped
+func (b *Broadcaster) send(v interface{}) bool {
+	select {
+	case <-b.stopC:
+		return false
+	default:
+	}
+	select {
+	case b.sendc <- v:
+		return true
+	case <-b.stopC:
+		return false
+	}
+}
 
-// Stop broadcast
+// Stop broadcast, it's safe to call Stop more than once and concurrently with Send
 func (b *Broadcaster) Stop() {
-	close(b.Sendc)
+	b.once.Do(func() {
+		close(b.stopC)
+	})
 }
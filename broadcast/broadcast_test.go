@@ -1,7 +1,9 @@
 package broadcast
 
 import (
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestB(t *testing.T) {
@@ -21,3 +23,206 @@ func TestB(t *testing.T) {
 		}
 	}
 }
+
+func TestNotifyNotBlock(t *testing.T) {
+	b := New(0)
+	// listeners never read
+	b.Notify(make(chan int))
+	b.NotifyLossy(make(chan int))
+	c := make(chan int, 1)
+	b.Notify(c)
+	doneC := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			b.Send(i)
+		}
+		close(doneC)
+	}()
+	for i := 0; i < 1000; i++ {
+		select {
+		case v := <-c:
+			if v != i {
+				t.Fatalf("Notify should not lose values, got %d expect %d", v, i)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("Notify should not block Send")
+		}
+	}
+	select {
+	case <-doneC:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Notify should not block Send")
+	}
+	waitFor(t, func() bool {
+		var lag, dropped int
+		for _, st := range b.Stats() {
+			lag += st.Lag
+			dropped += int(st.Dropped)
+		}
+		// unread Notify keeps all, NotifyLossy keeps 128 and 1 in flight
+		return lag == 1000+129 && dropped == 1000-129
+	})
+}
+
+func TestBufferPolicy(t *testing.T) {
+	// every subscriber takes 1 in flight and buffers 2, then drops or blocks
+	subscribe := func(policy Policy) (*Broadcaster, *Subscription, chan int) {
+		b := New(0)
+		c := make(chan int)
+		s, _ := b.Subscribe(c, WithBuffer(2, policy))
+		b.Send(1)
+		waitInflight(t, s)
+		for i := 2; i <= 4; i++ {
+			b.Send(i)
+		}
+		return b, s, c
+	}
+	expect := func(s *Subscription, c chan int, values ...int) {
+		waitFor(t, func() bool { return s.Stats().Lag == len(values) })
+		for _, v := range values {
+			if got := <-c; got != v {
+				t.Fatalf("expect %d, got %d", v, got)
+			}
+		}
+	}
+	b, s, c := subscribe(DropOldest)
+	waitFor(t, func() bool { return s.Stats().Dropped == 1 })
+	expect(s, c, 1, 3, 4)
+	waitFor(t, func() bool { return s.Stats().Delivered == 3 })
+	b.Stop()
+	b, s, c = subscribe(DropNewest)
+	waitFor(t, func() bool { return s.Stats().Dropped == 1 })
+	expect(s, c, 1, 2, 3)
+	b.Stop()
+	b, s, c = subscribe(Block)
+	sent := make(chan struct{})
+	go func() {
+		b.Send(5)
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("send should be blocked by block subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 4 is waiting for room
+	expect(s, c, 1, 2, 3)
+	<-sent
+	if v1, v2 := <-c, <-c; v1 != 4 || v2 != 5 || s.Stats().Dropped != 0 {
+		t.Fatal("block policy should not drop")
+	}
+	s.Close()
+	if len(b.Stats()) != 0 {
+		t.Fatal("closed subscription should be removed")
+	}
+	b.Stop()
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := New(0)
+	c := make(chan int)
+	s, _ := b.Subscribe(c)
+	b.Send(1)
+	// pump is blocked on unread channel, close should release it
+	b.Unsubscribe(s)
+	b.Send(2)
+	select {
+	case v := <-c:
+		t.Fatalf("should not receive %d after unsubscribe", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := b.Subscribe(make(chan string)); err == nil {
+		t.Fatal("bad channel type")
+	}
+	b.Stop()
+}
+
+func waitInflight(t *testing.T, s *Subscription) {
+	for i := 0; i < 100; i++ {
+		s.Lock()
+		inflight := s.inflight
+		s.Unlock()
+		if inflight == 1 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("value should be in flight")
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+func TestReplay(t *testing.T) {
+	b := New(0).Keep(3)
+	for i := 1; i <= 5; i++ {
+		b.Send(i)
+	}
+	waitFor(t, func() bool {
+		v, ok := b.Latest()
+		return ok && v.(int) == 5
+	})
+	recv := func(c chan int, n int) []int {
+		var list []int
+		for i := 0; i < n; i++ {
+			select {
+			case v := <-c:
+				list = append(list, v)
+			case <-time.After(time.Second):
+				t.Fatal("timeout")
+			}
+		}
+		return list
+	}
+	all, latest, none := make(chan int, 10), make(chan int, 10), make(chan int, 10)
+	b.Subscribe(all, WithReplay(10))
+	b.Subscribe(latest, WithLatest())
+	b.Subscribe(none)
+	b.Send(6)
+	if list := recv(all, 4); list[0] != 3 || list[1] != 4 || list[2] != 5 || list[3] != 6 {
+		t.Fatalf("replay got %v", list)
+	}
+	if list := recv(latest, 2); list[0] != 5 || list[1] != 6 {
+		t.Fatalf("latest got %v", list)
+	}
+	if list := recv(none, 1); list[0] != 6 {
+		t.Fatalf("got %v", list)
+	}
+
+	b.Stop()
+	b.Stop()
+	if b.Send(7) != ErrStopped {
+		t.Fatal("send after stop should fail")
+	}
+}
+
+func TestSendStop(t *testing.T) {
+	b := New(0)
+	b.Notify(make(chan int))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := b.Send(j); err != nil && err != ErrStopped {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond)
+	b.Stop()
+	b.Stop()
+	wg.Wait()
+	if err := b.Send(1); err != ErrStopped {
+		t.Fatal("send after stop should fail")
+	}
+}
@@ -0,0 +1,111 @@
+package broadcast
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Hub topic based pub/sub, topic is dot separated like "order.created";
+// in subscribe pattern "*" matches exactly one segment and "#" matches zero or more segments
+type Hub struct {
+	subs    map[*Subscription][]string
+	stopped bool
+	*sync.RWMutex
+}
+
+// NewHub create hub
+func NewHub() *Hub {
+	return &Hub{
+		subs:    make(map[*Subscription][]string),
+		RWMutex: new(sync.RWMutex),
+	}
+}
+
+// Subscribe listen to topics matching pattern by typpedChan, only values assignable to channel value type are delivered
+func (h *Hub) Subscribe(pattern string, typpedChan interface{}, opts ...SubOption) (*Subscription, error) {
+	if err := checkChan(typpedChan); err != nil {
+		return nil, err
+	}
+	s := newSubscription(h.remove, reflect.ValueOf(typpedChan), newSubOptions(opts))
+	h.Lock()
+	if h.stopped {
+		h.Unlock()
+		return nil, ErrStopped
+	}
+	h.subs[s] = strings.Split(pattern, ".")
+	h.Unlock()
+	go s.pump()
+	return s, nil
+}
+
+// Publish send value to subscribers of topic, it blocks if a Block subscriber is full
+func (h *Hub) Publish(topic string, v interface{}) error {
+	segments := strings.Split(topic, ".")
+	h.RLock()
+	if h.stopped {
+		h.RUnlock()
+		return ErrStopped
+	}
+	var subs []*Subscription
+	for s, pattern := range h.subs {
+		if matchTopic(pattern, segments) {
+			subs = append(subs, s)
+		}
+	}
+	h.RUnlock()
+	for _, s := range subs {
+		if s.accept(topic, v) {
+			s.offer(v)
+		}
+	}
+	return nil
+}
+
+// Stats stats of all subscriptions
+func (h *Hub) Stats() []SubStats {
+	h.RLock()
+	defer h.RUnlock()
+	list := make([]SubStats, 0, len(h.subs))
+	for s := range h.subs {
+		list = append(list, s.Stats())
+	}
+	return list
+}
+
+// Stop close all subscriptions
+func (h *Hub) Stop() {
+	h.Lock()
+	h.stopped = true
+	subs := h.subs
+	h.subs = make(map[*Subscription][]string)
+	h.Unlock()
+	for s := range subs {
+		s.close()
+	}
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.Lock()
+	delete(h.subs, s)
+	h.Unlock()
+}
+
+func matchTopic(pattern, topic []string) bool {
+	if len(pattern) == 0 {
+		return len(topic) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(topic); i++ {
+			if matchTopic(pattern[1:], topic[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(topic) > 0 && matchTopic(pattern[1:], topic[1:])
+	default:
+		return len(topic) > 0 && pattern[0] == topic[0] && matchTopic(pattern[1:], topic[1:])
+	}
+}
@@ -0,0 +1,78 @@
+package broadcast
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHub(t *testing.T) {
+	type Order struct {
+		ID     int
+		Amount int
+	}
+	h := NewHub()
+	all, created, big, names := make(chan Order, 10), make(chan Order, 10), make(chan Order, 10), make(chan string, 10)
+	h.Subscribe("order.#", all)
+	h.Subscribe("order.*.created", created)
+	h.Subscribe("order.#", big, WithFilter(func(topic string, v interface{}) bool {
+		return v.(Order).Amount > 100
+	}))
+	h.Subscribe("#", names)
+	h.Publish("order.vip.created", Order{ID: 1, Amount: 500})
+	h.Publish("order.paid", Order{ID: 2, Amount: 50})
+	h.Publish("order.normal.created", Order{ID: 3, Amount: 10})
+	h.Publish("user.login", "bob")
+	ids := func(c chan Order, n int) string {
+		var list []string
+		for i := 0; i < n; i++ {
+			select {
+			case o := <-c:
+				list = append(list, string('0'+byte(o.ID)))
+			case <-time.After(time.Second):
+				t.Fatal("timeout")
+			}
+		}
+		select {
+		case o := <-c:
+			t.Fatalf("unexpected %+v", o)
+		case <-time.After(20 * time.Millisecond):
+		}
+		return strings.Join(list, ",")
+	}
+	if s := ids(all, 3); s != "1,2,3" {
+		t.Fatalf("all got %s", s)
+	}
+	if s := ids(created, 2); s != "1,3" {
+		t.Fatalf("created got %s", s)
+	}
+	if s := ids(big, 1); s != "1" {
+		t.Fatalf("big got %s", s)
+	}
+	if s := <-names; s != "bob" || len(names) != 0 {
+		t.Fatal("only string values are delivered to string channel")
+	}
+	h.Stop()
+	if h.Publish("order.paid", Order{}) != ErrStopped {
+		t.Fatal("publish after stop")
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern, topic string
+		match          bool
+	}{
+		{"order.*", "order.paid", true},
+		{"order.*", "order.paid.ok", false},
+		{"order.#", "order", true},
+		{"#.paid", "order.vip.paid", true},
+		{"order.#.ok", "order.a.b.ok", true},
+		{"order.paid", "order.created", false},
+	}
+	for _, c := range cases {
+		if matchTopic(strings.Split(c.pattern, "."), strings.Split(c.topic, ".")) != c.match {
+			t.Fatalf("%s %s should be %v", c.pattern, c.topic, c.match)
+		}
+	}
+}
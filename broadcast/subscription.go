@@ -0,0 +1,242 @@
+package broadcast
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Policy buffer policy when subscriber falls behind and its buffer is full
+type Policy int
+
+const (
+	// Block sender waits until subscriber has room, it slows down all subscribers
+	Block Policy = iota
+	// DropOldest discard the oldest buffered value
+	DropOldest
+	// DropNewest discard the value being sent
+	DropNewest
+)
+
+// SubOption subscribe option
+type SubOption func(*subOptions)
+
+type subOptions struct {
+	size   int
+	policy Policy
+	replay int
+	filter func(topic string, v interface{}) bool
+}
+
+// WithBuffer buffer at most size values for subscriber, policy decides what to do when it's full
+func WithBuffer(size int, policy Policy) SubOption {
+	return func(opt *subOptions) {
+		if size > 0 {
+			opt.size = size
+		}
+		opt.policy = policy
+	}
+}
+
+// WithUnbounded buffer values without limit, sender never blocks and nothing is dropped,
+// memory grows while subscriber falls behind
+func WithUnbounded() SubOption {
+	return func(opt *subOptions) {
+		opt.size = 0
+	}
+}
+
+// WithFilter deliver only values accepted by fn, topic is empty for Broadcaster
+func WithFilter(fn func(topic string, v interface{}) bool) SubOption {
+	return func(opt *subOptions) {
+		opt.filter = fn
+	}
+}
+
+// WithReplay deliver last n kept values on subscribe, see Broadcaster.Keep; Hub doesn't replay
+func WithReplay(n int) SubOption {
+	return func(opt *subOptions) {
+		opt.replay = n
+	}
+}
+
+// WithLatest deliver the latest value on subscribe, like a behavior subject
+func WithLatest() SubOption {
+	return WithReplay(1)
+}
+
+// SubStats stats of subscription
+type SubStats struct {
+	Lag       int    // values received but not delivered yet
+	Delivered uint64 // values delivered to channel
+	Dropped   uint64 // values dropped by policy
+}
+
+// Subscription a listener of broadcaster
+type Subscription struct {
+	remove   func(*Subscription)
+	outC     reflect.Value
+	opt      subOptions
+	queue    []interface{}
+	inflight int
+	stats    SubStats
+	closed   bool
+	readyC   chan struct{}
+	spaceC   chan struct{}
+	closeC   chan struct{}
+	*sync.Mutex
+}
+
+func newSubscription(remove func(*Subscription), outC reflect.Value, opt subOptions) *Subscription {
+	return &Subscription{
+		remove: remove,
+		outC:   outC,
+		opt:    opt,
+		readyC: make(chan struct{}, 1),
+		spaceC: make(chan struct{}, 1),
+		closeC: make(chan struct{}),
+		Mutex:  new(sync.Mutex),
+	}
+}
+
+// Close stop delivering values, buffered values are discarded and the channel is not closed
+func (s *Subscription) Close() {
+	s.remove(s)
+	s.close()
+}
+
+// Stats stats of subscription
+func (s *Subscription) Stats() SubStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := s.stats
+	stats.Lag = len(s.queue) + s.inflight
+	return stats
+}
+
+func (s *Subscription) close() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.queue = nil
+		close(s.closeC)
+	}
+}
+
+// accept check value type and filter
+func (s *Subscription) accept(topic string, v interface{}) bool {
+	elem := s.outC.Type().Elem()
+	if v == nil {
+		switch elem.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		default:
+			return false
+		}
+	} else if !reflect.TypeOf(v).AssignableTo(elem) {
+		return false
+	}
+	return s.opt.filter == nil || s.opt.filter(topic, v)
+}
+
+// preload queue values before pumping, values beyond buffer size are handled by policy
+func (s *Subscription) preload(list []interface{}) {
+	for _, v := range list {
+		if !s.accept("", v) {
+			continue
+		}
+		if s.opt.size <= 0 || len(s.queue) < s.opt.size {
+			s.queue = append(s.queue, v)
+		} else if s.opt.policy == DropNewest {
+			s.stats.Dropped++
+		} else {
+			// can't block subscriber, keep the newest
+			s.queue = append(s.queue[1:], v)
+			s.stats.Dropped++
+		}
+	}
+	if len(s.queue) > 0 {
+		signal(s.readyC)
+	}
+}
+
+// offer buffer value by policy
+func (s *Subscription) offer(v interface{}) {
+	for {
+		s.Lock()
+		if s.closed {
+			s.Unlock()
+			return
+		}
+		if s.opt.size <= 0 || len(s.queue) < s.opt.size {
+			s.queue = append(s.queue, v)
+			s.Unlock()
+			signal(s.readyC)
+			return
+		}
+		switch s.opt.policy {
+		case DropNewest:
+			s.stats.Dropped++
+			s.Unlock()
+			return
+		case DropOldest:
+			s.queue = append(s.queue[1:], v)
+			s.stats.Dropped++
+			s.Unlock()
+			signal(s.readyC)
+			return
+		}
+		s.Unlock()
+		select {
+		case <-s.spaceC:
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// pump deliver buffered values to channel
+func (s *Subscription) pump() {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: s.outC},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.closeC)},
+	}
+	for {
+		s.Lock()
+		if s.closed {
+			s.Unlock()
+			return
+		}
+		if len(s.queue) == 0 {
+			s.Unlock()
+			select {
+			case <-s.readyC:
+			case <-s.closeC:
+				return
+			}
+			continue
+		}
+		v := s.queue[0]
+		s.queue = s.queue[1:]
+		s.inflight = 1
+		s.Unlock()
+		signal(s.spaceC)
+		cases[0].Send = reflect.ValueOf(v)
+		if v == nil {
+			cases[0].Send = reflect.Zero(s.outC.Type().Elem())
+		}
+		if chosen, _, _ := reflect.Select(cases); chosen == 1 {
+			return
+		}
+		s.Lock()
+		s.inflight = 0
+		s.stats.Delivered++
+		s.Unlock()
+	}
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
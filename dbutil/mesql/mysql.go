@@ -1,6 +1,7 @@
 package mesql
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/astaxie/beego/orm"
@@ -78,6 +79,11 @@ func GetOrmOf(alias string) Ormer {
 	return o
 }
 
+// GetDB get raw *sql.DB of alias registered by InitMysql, alias default is "default"
+func GetDB(alias ...string) (*sql.DB, error) {
+	return orm.GetDB(alias...)
+}
+
 type Task func() error
 
 func errHandler(task Task) (err error) {
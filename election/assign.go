@@ -0,0 +1,79 @@
+package election
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Assigner assign shards [0,shards) to members, return owner of every shard;
+// members are sorted and every member must get the same result for the same input
+type Assigner func(members []string, shards int) []string
+
+// Rendezvous highest random weight hashing, a shard only moves when its owner leaves or a new member wins it
+func Rendezvous(members []string, shards int) []string {
+	owners := make([]string, shards)
+	if len(members) == 0 {
+		return owners
+	}
+	for shard := 0; shard < shards; shard++ {
+		var max uint64
+		for i, m := range members {
+			if w := hashOf(m + "/" + strconv.Itoa(shard)); i == 0 || w > max {
+				max, owners[shard] = w, m
+			}
+		}
+	}
+	return owners
+}
+
+// ConsistentHash hash ring with replicas virtual nodes per member
+func ConsistentHash(replicas int) Assigner {
+	if replicas <= 0 {
+		replicas = 100
+	}
+	return func(members []string, shards int) []string {
+		owners := make([]string, shards)
+		if len(members) == 0 {
+			return owners
+		}
+		type vnode struct {
+			hash   uint64
+			member string
+		}
+		ring := make([]vnode, 0, len(members)*replicas)
+		for _, m := range members {
+			for i := 0; i < replicas; i++ {
+				ring = append(ring, vnode{hash: hashOf(m + "#" + strconv.Itoa(i)), member: m})
+			}
+		}
+		sort.Slice(ring, func(i, j int) bool {
+			if ring[i].hash == ring[j].hash {
+				return ring[i].member < ring[j].member
+			}
+			return ring[i].hash < ring[j].hash
+		})
+		for shard := 0; shard < shards; shard++ {
+			h := hashOf(strconv.Itoa(shard))
+			i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+			if i == len(ring) {
+				i = 0
+			}
+			owners[shard] = ring[i].member
+		}
+		return owners
+	}
+}
+
+// hashOf fnv-1a with a final mix, since fnv distributes poorly on similar short strings
+func hashOf(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
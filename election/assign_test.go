@@ -0,0 +1,32 @@
+package election
+
+import (
+	"testing"
+)
+
+func TestAssigners(t *testing.T) {
+	members := []string{"host1:1", "host2:1", "host3:1", "host4:1"}
+	shards := 256
+	for name, assign := range map[string]Assigner{"rendezvous": Rendezvous, "consistent": ConsistentHash(0)} {
+		owners := assign(members, shards)
+		count := make(map[string]int)
+		for _, m := range owners {
+			count[m]++
+		}
+		for _, m := range members {
+			if count[m] < shards/len(members)/3 {
+				t.Fatalf("%s: %s get too few shards %d", name, m, count[m])
+			}
+		}
+		// remove a member, only its shards move
+		after := assign(members[:3], shards)
+		for shard, m := range owners {
+			if m != members[3] && after[shard] != m {
+				t.Fatalf("%s: shard %d should not move from %s to %s", name, shard, m, after[shard])
+			}
+		}
+		if empty := assign(nil, 2); len(empty) != 2 || empty[0] != "" {
+			t.Fatalf("%s: no owner without members", name)
+		}
+	}
+}
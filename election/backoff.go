@@ -0,0 +1,35 @@
+package election
+
+import (
+	"context"
+	"time"
+)
+
+// backoff exponential retry interval
+type backoff struct {
+	min, max time.Duration
+	next     time.Duration
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{min: min, max: max, next: min}
+}
+
+// wait sleep current interval then double it, return false if ctx is done
+func (b *backoff) wait(ctx context.Context) bool {
+	timer := time.NewTimer(b.next)
+	defer timer.Stop()
+	if b.next *= 2; b.next > b.max {
+		b.next = b.max
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (b *backoff) reset() {
+	b.next = b.min
+}
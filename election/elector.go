@@ -0,0 +1,253 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Elector leader election, HA is backed by etcd, LeaseHA is backed by redis or mysql
+type Elector interface {
+	// Start block until Stop
+	Start() error
+	// Run block until ctx is done or Stop is called
+	Run(ctx context.Context) error
+	Stop()
+	IsLeader() bool
+	GetRole() Role
+	RoleC() <-chan Role
+	Observe() <-chan string
+	Leader() string
+	LeaderContext() context.Context
+	FencingToken() int64
+}
+
+var (
+	_ Elector = (*HA)(nil)
+	_ Elector = (*LeaseHA)(nil)
+)
+
+// runner lifecycle shared by electors and sharder
+type runner struct {
+	identity  string
+	stopC     chan struct{}
+	isStopped int32
+	logger    Logger
+	wg        *sync.WaitGroup
+	backoff   *backoff
+	*sync.RWMutex
+}
+
+func newRunner() *runner {
+	return &runner{
+		identity: defaultIdentity(),
+		stopC:    make(chan struct{}, 1),
+		logger:   NullLogger{},
+		wg:       new(sync.WaitGroup),
+		backoff:  newBackoff(100*time.Millisecond, 10*time.Second),
+		RWMutex:  new(sync.RWMutex),
+	}
+}
+
+// Stop running loop and wait it exit
+func (h *runner) Stop() {
+	h.Lock()
+	stopped := atomic.CompareAndSwapInt32(&h.isStopped, 0, 1)
+	h.Unlock()
+	if stopped {
+		close(h.stopC)
+		h.wg.Wait()
+	}
+}
+
+func (h *runner) setLogger(l Logger) {
+	if l != nil {
+		h.logger = l
+	}
+}
+
+func (h *runner) setIdentity(id string) {
+	if id != "" {
+		h.identity = id
+	}
+}
+
+func (h *runner) setBackoff(min, max time.Duration) {
+	if min > 0 && max >= min {
+		h.backoff = newBackoff(min, max)
+	}
+}
+
+// enter register a running loop, the returned context is cancelled when ctx is done or Stop is called
+func (h *runner) enter(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	// register to wg before Stop starts waiting
+	h.Lock()
+	if atomic.LoadInt32(&h.isStopped) == 1 {
+		h.Unlock()
+		return nil, nil, ErrStopped
+	}
+	h.wg.Add(1)
+	h.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-h.stopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		h.wg.Done()
+	}, nil
+}
+
+// exitErr error returned by Run
+func (h *runner) exitErr(ctx context.Context) error {
+	if atomic.LoadInt32(&h.isStopped) == 1 {
+		return ErrStopped
+	}
+	return ctx.Err()
+}
+
+// roleState role/leader notification shared by electors
+type roleState struct {
+	*runner
+	last      Role
+	leader    string
+	roleC     chan Role
+	leaderC   chan string
+	lease     *leaderLease
+	roleFns   []func(Role)
+	leaderFns []func(string)
+}
+
+func newRoleState() *roleState {
+	return &roleState{
+		runner:  newRunner(),
+		last:    Candidate,
+		roleC:   make(chan Role, 1),
+		leaderC: make(chan string, 1),
+		lease:   newLeaderLease(),
+	}
+}
+
+// IsLeader is leader
+func (h *roleState) IsLeader() bool {
+	return h.GetRole() == Leader
+}
+
+// GetRole current role
+func (h *roleState) GetRole() Role {
+	h.RLock()
+	defer h.RUnlock()
+	return h.last
+}
+
+// RoleC get roll channel, only the latest role is kept if the channel is not drained in time
+func (h *roleState) RoleC() <-chan Role {
+	return h.roleC
+}
+
+// Observe get identity of leader when leader changes, only the latest identity is kept if the channel is not drained in time
+func (h *roleState) Observe() <-chan string {
+	return h.leaderC
+}
+
+// Leader identity of current leader, empty if unknown
+func (h *roleState) Leader() string {
+	h.RLock()
+	defer h.RUnlock()
+	return h.leader
+}
+
+// LeaderContext context of current leadership, it's cancelled as soon as leadership is lost(session expired, leader key deleted or ha stopped),
+// a cancelled context is returned if not leader now
+func (h *roleState) LeaderContext() context.Context {
+	return h.lease.context()
+}
+
+// FencingToken token of current leadership, it increases monotonically across leaderships,
+// pass it to downstream writes so that they can reject a stale leader; 0 means not leader
+func (h *roleState) FencingToken() int64 {
+	return h.lease.token()
+}
+
+func (h *roleState) addRoleFn(fn func(Role)) {
+	if fn != nil {
+		h.Lock()
+		h.roleFns = append(h.roleFns, fn)
+		h.Unlock()
+	}
+}
+
+func (h *roleState) addLeaderFn(fn func(string)) {
+	if fn != nil {
+		h.Lock()
+		h.leaderFns = append(h.leaderFns, fn)
+		h.Unlock()
+	}
+}
+
+func (h *roleState) notifyState(state Role) {
+	h.Lock()
+	if h.last == state {
+		h.Unlock()
+		return
+	}
+	h.last = state
+	fns := h.roleFns
+	h.Unlock()
+	// keep the latest role if channel is full
+	for {
+		select {
+		case h.roleC <- state:
+		default:
+			select {
+			case <-h.roleC:
+			default:
+			}
+			continue
+		}
+		break
+	}
+	h.logger.Debugf("[election]switch to %s", state.String())
+	for _, fn := range fns {
+		fn(state)
+	}
+}
+
+func (h *roleState) notifyLeader(leader string) {
+	h.Lock()
+	if h.leader == leader {
+		h.Unlock()
+		return
+	}
+	h.leader = leader
+	fns := h.leaderFns
+	h.Unlock()
+	for {
+		select {
+		case h.leaderC <- leader:
+		default:
+			select {
+			case <-h.leaderC:
+			default:
+			}
+			continue
+		}
+		break
+	}
+	h.logger.Debugf("[election]leader is %s", leader)
+	for _, fn := range fns {
+		fn(leader)
+	}
+}
+
+func defaultIdentity() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
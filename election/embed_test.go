@@ -0,0 +1,33 @@
+package election
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/embed"
+)
+
+// startEtcd start a single node etcd for test, return client endpoint and stop func
+func startEtcd(t *testing.T) (string, func()) {
+	dir, _ := ioutil.TempDir("", "etcd")
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cu, _ := url.Parse("http://127.0.0.1:23790")
+	pu, _ := url.Parse("http://127.0.0.1:23800")
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*cu}, []url.URL{*cu}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*pu}, []url.URL{*pu}
+	cfg.InitialCluster = cfg.Name + "=http://127.0.0.1:23800"
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout")
+	}
+	return "127.0.0.1:23790", func() { e.Close(); os.RemoveAll(dir) }
+}
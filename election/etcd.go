@@ -3,14 +3,11 @@ package election
 import (
 	"context"
 	"errors"
-	"fmt"
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/clientv3/concurrency"
 	"go.etcd.io/etcd/mvcc/mvccpb"
 	"log"
-	"os"
-	"sync"
-	"sync/atomic"
+	"time"
 )
 
 type Role int
@@ -22,38 +19,30 @@ const (
 	Candidate = 2
 )
 
-// HA ha handler
+// ErrStopped returned by Run when Stop is called
+var ErrStopped = errors.New("already stopped")
+
+// HA ha handler backed by etcd
 type HA struct {
+	*roleState
 	endpoints []string
 	keyPrefix string
 	ttl       int
-	last      Role
-	roleC     chan Role
-	stopC     chan struct{}
-	isStopped int32
-	logger    Logger
-	wg        *sync.WaitGroup
 }
 
 // New new ha
 func New(endpoints []string, key string) *HA {
 	return &HA{
+		roleState: newRoleState(),
 		endpoints: endpoints,
 		keyPrefix: key,
-		last:      Candidate,
 		ttl:       30,
-		roleC:     make(chan Role, 1),
-		stopC:     make(chan struct{}, 1),
-		logger:    NullLogger{},
-		wg:        new(sync.WaitGroup),
 	}
 }
 
 // SetLogger logger
 func (h *HA) SetLogger(l Logger) *HA {
-	if l != nil {
-		h.logger = l
-	}
+	h.setLogger(l)
 	return h
 }
 
@@ -65,118 +54,158 @@ func (h *HA) TTL(ttl int) *HA {
 	return h
 }
 
-// IsLeader is leader
-func (h *HA) IsLeader() bool {
-	return h.last == Leader
+// Identity set value stored in election key, followers get it by Observe, default is hostname:pid
+func (h *HA) Identity(id string) *HA {
+	h.setIdentity(id)
+	return h
+}
+
+// RetryBackoff set wait interval after campaign/session failure, interval doubles from min up to max and is reset once elected
+func (h *HA) RetryBackoff(min, max time.Duration) *HA {
+	h.setBackoff(min, max)
+	return h
 }
 
-// GetRole current role
-func (h *HA) GetRole() Role {
-	return h.last
+// OnRoleChange register callback invoked on role switching, should be registered before Run/Start
+func (h *HA) OnRoleChange(fn func(Role)) *HA {
+	h.addRoleFn(fn)
+	return h
 }
 
-// RoleC get roll channel
-func (h *HA) RoleC() <-chan Role {
-	return h.roleC
+// OnLeaderChange register callback invoked with identity of new leader, should be registered before Run/Start
+func (h *HA) OnLeaderChange(fn func(string)) *HA {
+	h.addLeaderFn(fn)
+	return h
 }
 
-// Start start ha
+// Start start ha, block until Stop
 func (h *HA) Start() error {
-	if h.isStopped == 1 {
-		return errors.New("already stopped")
-	}
+	return h.Run(context.Background())
+}
+
+// Run start ha, block until ctx is done or Stop is called, return ctx.Err() or ErrStopped
+func (h *HA) Run(ctx context.Context) error {
 	if len(h.endpoints) == 0 {
 		return errors.New("no endpoints")
 	}
 	if h.keyPrefix == "" {
 		return errors.New("bad key")
 	}
+	ctx, exit, err := h.enter(ctx)
+	if err != nil {
+		return err
+	}
+	defer exit()
 	cli, err := clientv3.New(clientv3.Config{Endpoints: h.endpoints})
 	if err != nil {
 		h.logger.Errorf("[election]%v", err)
 		return err
 	}
 	defer cli.Close()
-	h.wg.Add(1)
-	defer h.wg.Done()
-	for h.isStopped == 0 {
-		h.startSession(cli)
-	}
-	return nil
-}
-
-// Stop ha
-func (h *HA) Stop() {
-	if atomic.CompareAndSwapInt32(&h.isStopped, 0, 1) {
-		close(h.stopC)
-		h.wg.Wait()
-	}
-}
-
-func (h *HA) notifyState(state Role) {
-	if h.last != state {
-		h.roleC <- state
-		h.last = state
-		h.logger.Debugf("[election]switch to %s", state.String())
+	for ctx.Err() == nil {
+		if !h.startSession(ctx, cli) && !h.backoff.wait(ctx) {
+			break
+		}
 	}
+	return h.exitErr(ctx)
 }
 
-func (h *HA) startSession(cli *clientv3.Client) {
-	session, err := concurrency.NewSession(cli, concurrency.WithTTL(h.ttl))
+// startSession campaign in a new session, return false if failed before elected
+func (h *HA) startSession(ctx context.Context, cli *clientv3.Client) bool {
+	session, err := concurrency.NewSession(cli, concurrency.WithTTL(h.ttl), concurrency.WithContext(ctx))
 	if err != nil {
 		h.logger.Errorf("[election]create session fail:%v", err)
-		return
+		return false
 	}
-	defer session.Close()
+	defer closeSession(cli, session)
 	defer h.notifyState(Candidate)
-	val := "election"
-	if h, err := os.Hostname(); err == nil {
-		val += fmt.Sprintf(":%s:%d", h, os.Getpid())
-	}
+	// revoke leadership before notify role change
+	defer h.lease.revoke()
 	elec := concurrency.NewElection(session, h.keyPrefix)
-	for {
-		if err := elec.Campaign(context.Background(), val); err != nil {
-			h.logger.Errorf("[election]campaign fail:%v", err)
-			h.notifyState(Candidate)
-			continue
-		}
-		lderVal, err := elec.Leader(context.Background())
-		if err != nil {
-			h.logger.Errorf("[election]get leader key fail:%v", err)
-			h.notifyState(Candidate)
-			continue
+	// sctx is done when ctx is done or session is expired
+	sctx, scancel := context.WithCancel(ctx)
+	defer scancel()
+	go func() {
+		select {
+		case <-session.Done():
+			scancel()
+		case <-sctx.Done():
 		}
-		if len(lderVal.Kvs) == 0 {
-			h.logger.Error("[election]get empty leader key")
-			h.notifyState(Candidate)
-			continue
+	}()
+	go h.observe(sctx, elec)
+	if err := elec.Campaign(sctx, h.identity); err != nil {
+		if sctx.Err() == nil {
+			h.logger.Errorf("[election]campaign fail:%v", err)
 		}
-		lderKey := string(lderVal.Kvs[0].Key)
-		cctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		h.logger.Debugf("[election]start watch key %s", lderKey)
-		wch := cli.Watch(cctx, lderKey, clientv3.WithRev(lderVal.Header.GetRevision()))
-		h.notifyState(Leader)
-		for {
-			select {
-			case <-h.stopC:
-				elec.Resign(context.Background())
-				return
-			case <-session.Done():
-				return
-			case wr := <-wch:
-				for _, ev := range wr.Events {
-					if ev.Type == mvccpb.DELETE {
-						h.logger.Debugf("[election] %s is lost unexpected, so resign myself", lderKey)
-						elec.Resign(context.Background())
-						return
-					}
+		return false
+	}
+	lderVal, err := elec.Leader(sctx)
+	if err != nil {
+		h.logger.Errorf("[election]get leader key fail:%v", err)
+		resign(elec)
+		return false
+	}
+	if len(lderVal.Kvs) == 0 {
+		h.logger.Error("[election]get empty leader key")
+		resign(elec)
+		return false
+	}
+	h.backoff.reset()
+	lderKey := string(lderVal.Kvs[0].Key)
+	h.logger.Debugf("[election]start watch key %s", lderKey)
+	wch := cli.Watch(sctx, lderKey, clientv3.WithRev(lderVal.Header.GetRevision()))
+	h.lease.grant(lderVal.Kvs[0].CreateRevision)
+	h.notifyState(Leader)
+	for {
+		select {
+		case <-ctx.Done():
+			h.lease.revoke()
+			resign(elec)
+			return true
+		case <-session.Done():
+			h.lease.revoke()
+			return true
+		case wr, ok := <-wch:
+			if !ok || wr.Err() != nil {
+				h.logger.Errorf("[election]watch %s fail:%v", lderKey, wr.Err())
+				h.lease.revoke()
+				resign(elec)
+				return true
+			}
+			for _, ev := range wr.Events {
+				if ev.Type == mvccpb.DELETE {
+					h.logger.Debugf("[election] %s is lost unexpected, so resign myself", lderKey)
+					h.lease.revoke()
+					resign(elec)
+					return true
 				}
 			}
 		}
 	}
 }
 
+func (h *HA) observe(ctx context.Context, elec *concurrency.Election) {
+	for resp := range elec.Observe(ctx) {
+		if len(resp.Kvs) > 0 {
+			h.notifyLeader(string(resp.Kvs[0].Value))
+		}
+	}
+}
+
+func resign(elec *concurrency.Election) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	elec.Resign(ctx)
+}
+
+// closeSession revoke session lease even if the session context is done
+func closeSession(cli *clientv3.Client, session *concurrency.Session) {
+	session.Orphan()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cli.Revoke(ctx, session.Lease())
+}
+
 func (r Role) String() string {
 	switch r {
 	case Leader:
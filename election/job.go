@@ -0,0 +1,140 @@
+package election
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/qjpcpu/common/redo"
+)
+
+// LeaderJob redo job which only runs on leader
+type LeaderJob struct {
+	elector  Elector
+	job      redo.Job
+	interval time.Duration
+	recipet  *redo.Recipet
+	wakeC    chan struct{}
+	stopC    chan struct{}
+	doneC    chan struct{}
+	once     *sync.Once
+	*sync.Mutex
+}
+
+// roleNotifier elector supports role change callbacks
+type roleNotifier interface {
+	addRoleFn(fn func(Role))
+}
+
+// leaderPollInterval how often LeaderContext is polled if elector has no role change callbacks
+const leaderPollInterval = time.Second
+
+// PerformOnLeader perform job every interval while e is leader, the job is stopped on demotion and
+// the current loop is waited to finish; RedoCtx.Context is derived from e.LeaderContext() so it's cancelled
+// as soon as leadership is lost. e.RoleC() is left to other consumers.
+// For graceful handover, Stop LeaderJob before stopping e
+func PerformOnLeader(e Elector, job redo.Job, interval time.Duration) *LeaderJob {
+	lj := &LeaderJob{
+		elector:  e,
+		job:      job,
+		interval: interval,
+		wakeC:    make(chan struct{}, 1),
+		stopC:    make(chan struct{}),
+		doneC:    make(chan struct{}),
+		once:     new(sync.Once),
+		Mutex:    new(sync.Mutex),
+	}
+	var pollC <-chan time.Time
+	if rn, ok := e.(roleNotifier); ok {
+		rn.addRoleFn(lj.wake)
+	} else {
+		ticker := time.NewTicker(leaderPollInterval)
+		go func() {
+			<-lj.doneC
+			ticker.Stop()
+		}()
+		pollC = ticker.C
+	}
+	go lj.loop(pollC)
+	return lj
+}
+
+// IsRunning job is running now
+func (lj *LeaderJob) IsRunning() bool {
+	lj.Lock()
+	defer lj.Unlock()
+	return lj.recipet != nil
+}
+
+// Stop stop job and wait current loop finished
+func (lj *LeaderJob) Stop() {
+	lj.once.Do(func() {
+		close(lj.stopC)
+	})
+	<-lj.doneC
+}
+
+// WaitChan channel would be closed when LeaderJob stopped
+func (lj *LeaderJob) WaitChan() <-chan struct{} {
+	return lj.doneC
+}
+
+// wake notify loop of role change without blocking elector
+func (lj *LeaderJob) wake(Role) {
+	select {
+	case lj.wakeC <- struct{}{}:
+	default:
+	}
+}
+
+func (lj *LeaderJob) loop(pollC <-chan time.Time) {
+	defer close(lj.doneC)
+	// leadership the running job belongs to
+	started := lj.follow(nil)
+	for {
+		var leaderDone <-chan struct{}
+		if started != nil {
+			leaderDone = started.Done()
+		}
+		select {
+		case <-lj.stopC:
+			lj.halt()
+			return
+		case <-lj.wakeC:
+			started = lj.follow(started)
+		case <-pollC:
+			started = lj.follow(started)
+		case <-leaderDone:
+			// leadership lost before role notification, it may be re-acquired already
+			started = lj.follow(started)
+		}
+	}
+}
+
+// follow keep job running for current leadership, a new leadership restarts job, return leadership of running job
+func (lj *LeaderJob) follow(started context.Context) context.Context {
+	ctx := lj.elector.LeaderContext()
+	if ctx == started && ctx.Err() == nil {
+		return started
+	}
+	lj.halt()
+	if ctx.Err() != nil {
+		return nil
+	}
+	lj.Lock()
+	lj.recipet = redo.Perform(lj.job, lj.interval, redo.WithContext(ctx))
+	lj.Unlock()
+	return ctx
+}
+
+// halt stop job and wait current loop finished
+func (lj *LeaderJob) halt() {
+	lj.Lock()
+	recipet := lj.recipet
+	lj.recipet = nil
+	lj.Unlock()
+	if recipet != nil {
+		recipet.Stop()
+		recipet.Wait()
+	}
+}
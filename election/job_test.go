@@ -0,0 +1,168 @@
+package election
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/qjpcpu/common/redisutil"
+	"github.com/qjpcpu/common/redo"
+)
+
+func TestPerformOnLeader(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pool := redisutil.CreatePool(s.Addr(), "", "")
+	var running, count1, count2 int32
+	newJob := func(count *int32) redo.Job {
+		return func(ctx *redo.RedoCtx) {
+			if atomic.AddInt32(&running, 1) > 1 {
+				t.Error("job should run on single node")
+			}
+			atomic.AddInt32(count, 1)
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}
+	}
+	h1 := NewRedis(pool, "/job-key").TTL(1)
+	j1 := PerformOnLeader(h1, newJob(&count1), time.Millisecond)
+	go h1.Start()
+	waitUntil(t, "job should run on leader", func() bool { return atomic.LoadInt32(&count1) > 0 })
+	select {
+	case role := <-h1.RoleC():
+		if role != Leader {
+			t.Fatalf("bad role %v", role)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RoleC should be left to other consumers")
+	}
+	h2 := NewRedis(pool, "/job-key").TTL(1)
+	j2 := PerformOnLeader(h2, newJob(&count2), time.Millisecond)
+	go h2.Start()
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&count2) != 0 || j2.IsRunning() {
+		t.Fatal("job should not run on candidate")
+	}
+	// graceful handover
+	j1.Stop()
+	if j1.IsRunning() || atomic.LoadInt32(&running) != 0 {
+		t.Fatal("job should be finished")
+	}
+	h1.Stop()
+	waitUntil(t, "job should run on new leader", func() bool { return atomic.LoadInt32(&count2) > 0 })
+	// demotion stops job
+	s.Del("/job-key")
+	s.Set("/job-key", "1|other")
+	waitUntil(t, "job should stop on demotion", func() bool { return !j2.IsRunning() })
+	n := atomic.LoadInt32(&count2)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&count2) != n {
+		t.Fatal("job should not run after demotion")
+	}
+	j2.Stop()
+	h2.Stop()
+}
+
+func TestPerformOnLeaderReacquire(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pool := redisutil.CreatePool(s.Addr(), "", "")
+	var count int32
+	h := NewRedis(pool, "/reacquire-key").TTL(1)
+	j := PerformOnLeader(h, func(ctx *redo.RedoCtx) { atomic.AddInt32(&count, 1) }, time.Millisecond)
+	go h.Start()
+	defer h.Stop()
+	defer j.Stop()
+	waitUntil(t, "job should run on leader", func() bool { return atomic.LoadInt32(&count) > 0 })
+	for i := 0; i < 5; i++ {
+		// lease is lost and re-acquired in one tick, role notifications collapse to Leader
+		token := h.FencingToken()
+		s.Del("/reacquire-key")
+		waitUntil(t, "should re-acquire lease", func() bool { return h.FencingToken() > token })
+		waitUntil(t, "job should run for new leadership", j.IsRunning)
+		n := atomic.LoadInt32(&count)
+		waitUntil(t, "job should keep running", func() bool { return atomic.LoadInt32(&count) > n })
+	}
+}
+
+// fakeElector elector whose leadership is switched by test
+type fakeElector struct {
+	Elector
+	ctx atomic.Value
+	fns []func(Role)
+	sync.Mutex
+}
+
+func (e *fakeElector) LeaderContext() context.Context { return e.ctx.Load().(context.Context) }
+
+func (e *fakeElector) addRoleFn(fn func(Role)) {
+	e.Lock()
+	defer e.Unlock()
+	e.fns = append(e.fns, fn)
+}
+
+func (e *fakeElector) notify(role Role) {
+	e.Lock()
+	defer e.Unlock()
+	for _, fn := range e.fns {
+		fn(role)
+	}
+}
+
+func TestPerformOnLeaderRoleBeforeLoss(t *testing.T) {
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	e := &fakeElector{}
+	e.ctx.Store(ctx1)
+	var count int32
+	j := PerformOnLeader(e, func(ctx *redo.RedoCtx) { atomic.AddInt32(&count, 1) }, time.Millisecond)
+	defer j.Stop()
+	waitUntil(t, "job should run on leader", func() bool { return atomic.LoadInt32(&count) > 0 })
+	// new leadership is notified before the old one is seen lost
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	e.ctx.Store(ctx2)
+	e.notify(Leader)
+	time.Sleep(20 * time.Millisecond)
+	cancel1()
+	time.Sleep(20 * time.Millisecond)
+	n := atomic.LoadInt32(&count)
+	waitUntil(t, "job should run for new leadership", func() bool { return j.IsRunning() && atomic.LoadInt32(&count) > n })
+}
+
+func TestPerformOnLeaderCancelJob(t *testing.T) {
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	e := &fakeElector{}
+	e.ctx.Store(ctx1)
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	j := PerformOnLeader(e, func(ctx *redo.RedoCtx) {
+		if ctx.Iteration() != 1 {
+			return
+		}
+		close(started)
+		select {
+		case <-ctx.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}, time.Millisecond)
+	defer j.Stop()
+	<-started
+	// leadership is lost while job is running
+	cancel1()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("job context should be cancelled with leadership")
+	}
+	waitUntil(t, "job should stop", func() bool { return !j.IsRunning() })
+}
@@ -0,0 +1,81 @@
+package election
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// leaderLease hold leader context and fencing token of current leadership
+type leaderLease struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	rev    int64
+	timer  *time.Timer
+	*sync.RWMutex
+}
+
+func newLeaderLease() *leaderLease {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return &leaderLease{
+		ctx:     ctx,
+		cancel:  cancel,
+		RWMutex: new(sync.RWMutex),
+	}
+}
+
+// grant start a new leadership with fencing token rev
+func (l *leaderLease) grant(rev int64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.Lock()
+	l.stopTimer()
+	l.cancel()
+	l.ctx, l.cancel, l.rev = ctx, cancel, rev
+	l.Unlock()
+}
+
+// expireAt revoke current leadership at t unless it's granted again or expireAt is called again,
+// so that leadership ends in time even if renewal hangs
+func (l *leaderLease) expireAt(t time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	l.stopTimer()
+	ctx := l.ctx
+	l.timer = time.AfterFunc(time.Until(t), func() {
+		l.Lock()
+		defer l.Unlock()
+		if l.ctx == ctx {
+			l.cancel()
+			l.rev = 0
+		}
+	})
+}
+
+func (l *leaderLease) stopTimer() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+}
+
+// revoke cancel current leadership, it's safe to call multiple times
+func (l *leaderLease) revoke() {
+	l.Lock()
+	l.stopTimer()
+	l.cancel()
+	l.rev = 0
+	l.Unlock()
+}
+
+func (l *leaderLease) context() context.Context {
+	l.RLock()
+	defer l.RUnlock()
+	return l.ctx
+}
+
+func (l *leaderLease) token() int64 {
+	l.RLock()
+	defer l.RUnlock()
+	return l.rev
+}
@@ -0,0 +1,183 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// leaseStore storage of expirable leader lease
+type leaseStore interface {
+	// acquire lease if nobody holds it, return fencing token or 0 if held by others
+	acquire(ctx context.Context, identity string, ttl time.Duration) (int64, error)
+	// renew lease held by identity with token, return false if lease is lost
+	renew(ctx context.Context, identity string, token int64, ttl time.Duration) (bool, error)
+	// release lease held by identity with token
+	release(ctx context.Context, identity string, token int64) error
+	// holder identity of current lease holder, empty if nobody
+	holder(ctx context.Context) (string, error)
+}
+
+// LeaseHA ha handler backed by an expirable lease in redis or mysql,
+// the leader renews lease every ttl/3 and steps down as soon as renewal fails;
+// LeaderContext is cancelled when lease expires even if the store hangs
+type LeaseHA struct {
+	*roleState
+	store      leaseStore
+	ttl        time.Duration
+	token      int64
+	validUntil time.Time
+}
+
+func newLeaseHA(store leaseStore) *LeaseHA {
+	return &LeaseHA{
+		roleState: newRoleState(),
+		store:     store,
+		ttl:       30 * time.Second,
+	}
+}
+
+// SetLogger logger
+func (h *LeaseHA) SetLogger(l Logger) *LeaseHA {
+	h.setLogger(l)
+	return h
+}
+
+// TTL set lease ttl in seconds
+func (h *LeaseHA) TTL(ttl int) *LeaseHA {
+	if ttl > 0 {
+		h.ttl = time.Duration(ttl) * time.Second
+	}
+	return h
+}
+
+// Identity set value stored in lease, followers get it by Observe, default is hostname:pid
+func (h *LeaseHA) Identity(id string) *LeaseHA {
+	h.setIdentity(id)
+	return h
+}
+
+// RetryBackoff set wait interval after storage failure, interval doubles from min up to max and is reset after success
+func (h *LeaseHA) RetryBackoff(min, max time.Duration) *LeaseHA {
+	h.setBackoff(min, max)
+	return h
+}
+
+// OnRoleChange register callback invoked on role switching, should be registered before Run/Start
+func (h *LeaseHA) OnRoleChange(fn func(Role)) *LeaseHA {
+	h.addRoleFn(fn)
+	return h
+}
+
+// OnLeaderChange register callback invoked with identity of new leader, should be registered before Run/Start
+func (h *LeaseHA) OnLeaderChange(fn func(string)) *LeaseHA {
+	h.addLeaderFn(fn)
+	return h
+}
+
+// Start start ha, block until Stop
+func (h *LeaseHA) Start() error {
+	return h.Run(context.Background())
+}
+
+// Run start ha, block until ctx is done or Stop is called, return ctx.Err() or ErrStopped
+func (h *LeaseHA) Run(ctx context.Context) error {
+	if h.store == nil {
+		return errors.New("no lease store")
+	}
+	ctx, exit, err := h.enter(ctx)
+	if err != nil {
+		return err
+	}
+	defer exit()
+	defer h.notifyState(Candidate)
+	defer h.stepDown()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return h.exitErr(ctx)
+		case <-timer.C:
+		}
+		if err := h.tick(ctx); err != nil {
+			if ctx.Err() == nil {
+				h.logger.Errorf("[election]%v", err)
+			}
+			if !h.backoff.wait(ctx) {
+				return h.exitErr(ctx)
+			}
+			timer.Reset(0)
+			continue
+		}
+		h.backoff.reset()
+		timer.Reset(h.ttl / 3)
+	}
+}
+
+func (h *LeaseHA) tick(ctx context.Context) error {
+	if h.token > 0 {
+		start := time.Now()
+		if start.After(h.validUntil) {
+			h.logger.Debugf("[election]lease expired before renewal, so resign myself")
+			h.stepDown()
+			h.notifyState(Candidate)
+		} else if ok, err := h.renew(ctx); err != nil || !ok {
+			h.logger.Debugf("[election]renew lease fail, so resign myself")
+			h.stepDown()
+			h.notifyState(Candidate)
+			if err != nil {
+				return err
+			}
+		} else {
+			h.validUntil = start.Add(h.ttl)
+			h.lease.expireAt(h.validUntil)
+		}
+	}
+	if h.token == 0 {
+		start := time.Now()
+		cctx, cancel := context.WithTimeout(ctx, h.ttl/3)
+		token, err := h.store.acquire(cctx, h.identity, h.ttl)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if token > 0 {
+			h.token, h.validUntil = token, start.Add(h.ttl)
+			h.lease.grant(token)
+			h.lease.expireAt(h.validUntil)
+			h.notifyState(Leader)
+		}
+	}
+	cctx, cancel := context.WithTimeout(ctx, h.ttl/3)
+	defer cancel()
+	holder, err := h.store.holder(cctx)
+	if err != nil {
+		return err
+	}
+	if holder != "" {
+		h.notifyLeader(holder)
+	}
+	return nil
+}
+
+// renew lease, the call must return before lease expires, or a hung store would keep leadership
+func (h *LeaseHA) renew(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithDeadline(ctx, h.validUntil.Add(-h.ttl/10))
+	defer cancel()
+	return h.store.renew(ctx, h.identity, h.token, h.ttl)
+}
+
+// stepDown revoke leadership and release lease, it's safe to call when not leader
+func (h *LeaseHA) stepDown() {
+	h.lease.revoke()
+	if h.token == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := h.store.release(ctx, h.identity, h.token); err != nil {
+		h.logger.Errorf("[election]release lease fail:%v", err)
+	}
+	h.token = 0
+}
@@ -0,0 +1,63 @@
+package election
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hangStore lease store which hangs on renew after hang is set
+type hangStore struct {
+	hang        int32
+	noDeadline  int32
+	renewCalled int32
+}
+
+func (s *hangStore) acquire(ctx context.Context, identity string, ttl time.Duration) (int64, error) {
+	return 1, nil
+}
+
+func (s *hangStore) renew(ctx context.Context, identity string, token int64, ttl time.Duration) (bool, error) {
+	atomic.AddInt32(&s.renewCalled, 1)
+	if _, ok := ctx.Deadline(); !ok {
+		atomic.StoreInt32(&s.noDeadline, 1)
+	}
+	if atomic.LoadInt32(&s.hang) == 1 {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return true, nil
+}
+
+func (s *hangStore) release(ctx context.Context, identity string, token int64) error {
+	return nil
+}
+
+func (s *hangStore) holder(ctx context.Context) (string, error) {
+	return "node1", nil
+}
+
+func TestLeaseExpireOnHungStore(t *testing.T) {
+	store := &hangStore{}
+	h := newLeaseHA(store).Identity("node1")
+	h.ttl = 300 * time.Millisecond
+	go h.Start()
+	defer h.Stop()
+	waitUntil(t, "should be leader", h.IsLeader)
+	waitUntil(t, "should renew", func() bool { return atomic.LoadInt32(&store.renewCalled) > 0 })
+	atomic.StoreInt32(&store.hang, 1)
+	ctx := h.LeaderContext()
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("leader context should be cancelled when lease expires")
+	}
+	if elapsed := time.Since(start); elapsed > h.ttl {
+		t.Fatalf("leadership kept %v after store hangs", elapsed)
+	}
+	if atomic.LoadInt32(&store.noDeadline) == 1 {
+		t.Fatal("renew should have deadline")
+	}
+}
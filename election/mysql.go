@@ -0,0 +1,116 @@
+package election
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MysqlLeaseDDL create table statement of lease table, format it with table name
+const MysqlLeaseDDL = "CREATE TABLE IF NOT EXISTS `%s` (" +
+	"`name` VARCHAR(128) NOT NULL," +
+	"`holder` VARCHAR(255) NOT NULL," +
+	"`token` BIGINT NOT NULL," +
+	"`expire_at` BIGINT NOT NULL COMMENT 'unix milliseconds'," +
+	"PRIMARY KEY (`name`)" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+// DefaultMysqlLeaseTable default lease table name
+const DefaultMysqlLeaseTable = "election_lease"
+
+// current unix milliseconds of mysql server, so clock of clients doesn't matter
+const mysqlNowMs = "CAST(UNIX_TIMESTAMP(NOW(3))*1000 AS SIGNED)"
+
+// NewMysql create ha backed by a lease row of table(see MysqlLeaseDDL), every election key takes one row,
+// db can be got by mesql.GetDB
+func NewMysql(db *sql.DB, table, key string) *LeaseHA {
+	if table == "" {
+		table = DefaultMysqlLeaseTable
+	}
+	return newLeaseHA(&mysqlStore{db: db, table: table, key: key})
+}
+
+type mysqlStore struct {
+	db    *sql.DB
+	table string
+	key   string
+}
+
+func (s *mysqlStore) acquire(ctx context.Context, identity string, ttl time.Duration) (token int64, err error) {
+	ms := int64(ttl / time.Millisecond)
+	res, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("INSERT IGNORE INTO `%s` (`name`,`holder`,`token`,`expire_at`) VALUES (?,?,1,%s+?)", s.table, mysqlNowMs),
+		s.key, identity, ms,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 1 {
+		return 1, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	res, err = tx.ExecContext(ctx,
+		fmt.Sprintf("UPDATE `%s` SET `holder`=?,`token`=`token`+1,`expire_at`=%s+? WHERE `name`=? AND `expire_at`<%s", s.table, mysqlNowMs, mysqlNowMs),
+		identity, ms, s.key,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		// row is locked by update until commit
+		if err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT `token` FROM `%s` WHERE `name`=?", s.table), s.key).Scan(&token); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return token, nil
+}
+
+func (s *mysqlStore) renew(ctx context.Context, identity string, token int64, ttl time.Duration) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("UPDATE `%s` SET `expire_at`=%s+? WHERE `name`=? AND `holder`=? AND `token`=? AND `expire_at`>=%s", s.table, mysqlNowMs, mysqlNowMs),
+		int64(ttl/time.Millisecond), s.key, identity, token,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *mysqlStore) release(ctx context.Context, identity string, token int64) error {
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("UPDATE `%s` SET `expire_at`=0 WHERE `name`=? AND `holder`=? AND `token`=?", s.table),
+		s.key, identity, token,
+	)
+	return err
+}
+
+func (s *mysqlStore) holder(ctx context.Context) (string, error) {
+	var holder string
+	err := s.db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT `holder` FROM `%s` WHERE `name`=? AND `expire_at`>=%s", s.table, mysqlNowMs),
+		s.key,
+	).Scan(&holder)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return holder, err
+}
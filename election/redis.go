@@ -0,0 +1,115 @@
+package election
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// lease value is "token|identity", token is increased in key:token on every acquisition
+// redis-cli --eval acquire.lua key key:token , identity ttl_ms
+var acquireScript = redis.NewScript(2, `
+local token = tonumber(redis.call("GET", KEYS[2]) or "0") + 1
+if redis.call("SET", KEYS[1], token .. "|" .. ARGV[1], "NX", "PX", ARGV[2]) then
+  redis.call("SET", KEYS[2], token)
+  return token
+end
+return 0
+`)
+
+// redis-cli --eval renew.lua key , value ttl_ms
+var renewScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// redis-cli --eval release.lua key , value
+var releaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// NewRedis create ha backed by redis lease(SET NX PX), key and key:token should be in the same slot for redis cluster proxy
+func NewRedis(pool *redis.Pool, key string) *LeaseHA {
+	return newLeaseHA(&redisStore{pool: pool, key: key})
+}
+
+type redisStore struct {
+	pool *redis.Pool
+	key  string
+}
+
+func (s *redisStore) acquire(ctx context.Context, identity string, ttl time.Duration) (int64, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return redis.Int64(acquireScript.Do(ctxConn{conn, ctx}, s.key, s.key+":token", identity, int64(ttl/time.Millisecond)))
+}
+
+func (s *redisStore) renew(ctx context.Context, identity string, token int64, ttl time.Duration) (bool, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return redis.Bool(renewScript.Do(ctxConn{conn, ctx}, s.key, redisLeaseValue(identity, token), int64(ttl/time.Millisecond)))
+}
+
+func (s *redisStore) release(ctx context.Context, identity string, token int64) error {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = releaseScript.Do(ctxConn{conn, ctx}, s.key, redisLeaseValue(identity, token))
+	return err
+}
+
+func (s *redisStore) holder(ctx context.Context) (string, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	val, err := redis.String(ctxConn{conn, ctx}.Do("GET", s.key))
+	if err == redis.ErrNil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if i := strings.Index(val, "|"); i >= 0 {
+		val = val[i+1:]
+	}
+	return val, nil
+}
+
+func redisLeaseValue(identity string, token int64) string {
+	return strconv.FormatInt(token, 10) + "|" + identity
+}
+
+// ctxConn bound command time by ctx deadline
+type ctxConn struct {
+	redis.Conn
+	ctx context.Context
+}
+
+func (c ctxConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	deadline, ok := c.ctx.Deadline()
+	if !ok {
+		return c.Conn.Do(cmd, args...)
+	}
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
@@ -0,0 +1,63 @@
+package election
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/qjpcpu/common/redisutil"
+)
+
+func waitUntil(t *testing.T, msg string, cond func() bool) {
+	deadline := time.After(5 * time.Second)
+	for !cond() {
+		select {
+		case <-deadline:
+			t.Fatal(msg)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRedisElection(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pool := redisutil.CreatePool(s.Addr(), "", "")
+	h1 := NewRedis(pool, "/share-key").Identity("node1").TTL(1)
+	go h1.Start()
+	if role := <-h1.RoleC(); role != Leader {
+		t.Fatalf("should be leader, got %v", role)
+	}
+	token := h1.FencingToken()
+	if token <= 0 || h1.LeaderContext().Err() != nil {
+		t.Fatal("should hold lease")
+	}
+	var h2 Elector = NewRedis(pool, "/share-key").Identity("node2").TTL(1)
+	go h2.Start()
+	waitUntil(t, "node2 should observe node1", func() bool { return h2.Leader() == "node1" })
+	if h2.IsLeader() {
+		t.Fatal("node2 should be candidate")
+	}
+	ctx := h1.LeaderContext()
+	h1.Stop()
+	if ctx.Err() == nil || h1.IsLeader() {
+		t.Fatal("node1 should resign")
+	}
+	waitUntil(t, "node2 should be leader", h2.IsLeader)
+	if h2.FencingToken() <= token {
+		t.Fatal("fencing token should increase")
+	}
+	waitUntil(t, "node2 should observe itself", func() bool { return h2.Leader() == "node2" })
+	// lease lost unexpected, node2 resigns and acquires a new lease
+	token = h2.FencingToken()
+	ctx = h2.LeaderContext()
+	s.Del("/share-key")
+	waitUntil(t, "node2 should acquire new lease", func() bool { return h2.FencingToken() > token })
+	if ctx.Err() == nil {
+		t.Fatal("old leader context should be cancelled")
+	}
+	h2.Stop()
+}
@@ -0,0 +1,448 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/concurrency"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+)
+
+// ShardEventType type of shard event
+type ShardEventType int
+
+const (
+	// ShardAssigned shard is owned by this member now, start working on it
+	ShardAssigned ShardEventType = 1
+	// ShardRevoked shard is moving to another member, stop working on it and call Done once drained
+	ShardRevoked ShardEventType = 2
+)
+
+func (t ShardEventType) String() string {
+	switch t {
+	case ShardAssigned:
+		return "Assigned"
+	case ShardRevoked:
+		return "Revoked"
+	default:
+		return "Unknown"
+	}
+}
+
+// ShardEvent assignment change of a shard
+type ShardEvent struct {
+	Type  ShardEventType
+	Shard int
+	done  func()
+}
+
+// Done ack revoked shard is drained, the new owner would get the shard only after Done; it's noop for assigned shard
+func (ev ShardEvent) Done() {
+	if ev.done != nil {
+		ev.done()
+	}
+}
+
+// Sharder split shards across live members of a group, every member registers itself with an etcd session lease,
+// a shard is held by a lease key <key>/shards/<n> so that a shard never has two owners at the same time
+type Sharder struct {
+	*runner
+	endpoints    []string
+	keyPrefix    string
+	ttl          int
+	shards       int
+	assign       Assigner
+	drainTimeout time.Duration
+	eventC       chan ShardEvent
+	members      []string
+	owned        map[int]bool
+}
+
+// NewSharder create sharder of shards [0,shards) among members sharing key
+func NewSharder(endpoints []string, key string, shards int) *Sharder {
+	if shards < 0 {
+		shards = 0
+	}
+	return &Sharder{
+		runner:       newRunner(),
+		endpoints:    endpoints,
+		keyPrefix:    strings.TrimSuffix(key, "/"),
+		ttl:          30,
+		shards:       shards,
+		assign:       Rendezvous,
+		drainTimeout: 30 * time.Second,
+		eventC:       make(chan ShardEvent, shards*2),
+		owned:        make(map[int]bool),
+	}
+}
+
+// SetLogger logger
+func (s *Sharder) SetLogger(l Logger) *Sharder {
+	s.setLogger(l)
+	return s
+}
+
+// TTL set member session ttl
+func (s *Sharder) TTL(ttl int) *Sharder {
+	if ttl > 0 {
+		s.ttl = ttl
+	}
+	return s
+}
+
+// Identity set member identity, it should be unique in the group, default is hostname:pid
+func (s *Sharder) Identity(id string) *Sharder {
+	s.setIdentity(id)
+	return s
+}
+
+// RetryBackoff set wait interval after session failure, interval doubles from min up to max
+func (s *Sharder) RetryBackoff(min, max time.Duration) *Sharder {
+	s.setBackoff(min, max)
+	return s
+}
+
+// Assigner set assignment algorithm, default is Rendezvous, all members must use the same one
+func (s *Sharder) Assigner(a Assigner) *Sharder {
+	if a != nil {
+		s.assign = a
+	}
+	return s
+}
+
+// DrainTimeout max time waiting revoked shards drained when stopping, default 30s
+func (s *Sharder) DrainTimeout(d time.Duration) *Sharder {
+	if d > 0 {
+		s.drainTimeout = d
+	}
+	return s
+}
+
+// EventC get shard events, the channel must be drained or the sharder would be blocked
+func (s *Sharder) EventC() <-chan ShardEvent {
+	return s.eventC
+}
+
+// Shards owned by this member and not revoked
+func (s *Sharder) Shards() []int {
+	s.RLock()
+	defer s.RUnlock()
+	var list []int
+	for shard, ok := range s.owned {
+		if ok {
+			list = append(list, shard)
+		}
+	}
+	sort.Ints(list)
+	return list
+}
+
+// Members live members of the group
+func (s *Sharder) Members() []string {
+	s.RLock()
+	defer s.RUnlock()
+	return append([]string(nil), s.members...)
+}
+
+// Start start sharder, block until Stop
+func (s *Sharder) Start() error {
+	return s.Run(context.Background())
+}
+
+// Run start sharder, block until ctx is done or Stop is called, return ctx.Err() or ErrStopped;
+// owned shards are revoked and waited to be drained before exit
+func (s *Sharder) Run(ctx context.Context) error {
+	if len(s.endpoints) == 0 {
+		return errors.New("no endpoints")
+	}
+	if s.keyPrefix == "" || s.shards == 0 {
+		return errors.New("bad key or shards")
+	}
+	ctx, exit, err := s.enter(ctx)
+	if err != nil {
+		return err
+	}
+	defer exit()
+	cli, err := clientv3.New(clientv3.Config{Endpoints: s.endpoints})
+	if err != nil {
+		s.logger.Errorf("[sharder]%v", err)
+		return err
+	}
+	defer cli.Close()
+	for ctx.Err() == nil {
+		if err := s.startSession(ctx, cli); err != nil {
+			s.logger.Errorf("[sharder]%v", err)
+			if !s.backoff.wait(ctx) {
+				break
+			}
+		} else {
+			s.backoff.reset()
+		}
+	}
+	return s.exitErr(ctx)
+}
+
+// shardSession state of a single etcd session
+type shardSession struct {
+	*Sharder
+	cli      *clientv3.Client
+	session  *concurrency.Session
+	live     map[string]bool
+	holders  map[int]string
+	draining map[int]bool
+	drainedC chan int
+	quitC    chan struct{}
+	exitC    <-chan struct{}
+	giveUpAt time.Time
+}
+
+func (s *Sharder) startSession(ctx context.Context, cli *clientv3.Client) error {
+	// session is not bound to ctx, so that it keeps alive while draining
+	session, err := concurrency.NewSession(cli, concurrency.WithTTL(s.ttl))
+	if err != nil {
+		return err
+	}
+	defer closeSession(cli, session)
+	ss := &shardSession{
+		Sharder:  s,
+		cli:      cli,
+		session:  session,
+		live:     make(map[string]bool),
+		holders:  make(map[int]string),
+		draining: make(map[int]bool),
+		drainedC: make(chan int, s.shards),
+		quitC:    make(chan struct{}),
+		exitC:    ctx.Done(),
+	}
+	defer close(ss.quitC)
+	return ss.run(ctx)
+}
+
+func (ss *shardSession) run(ctx context.Context) error {
+	wctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := ss.cli.Put(ctx, ss.memberKey(ss.identity), ss.identity, clientv3.WithLease(ss.session.Lease())); err != nil {
+		return err
+	}
+	resp, err := ss.cli.Get(ctx, ss.keyPrefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		ss.apply(mvccpb.PUT, kv)
+	}
+	wch := ss.cli.Watch(wctx, ss.keyPrefix+"/", clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	if err := ss.reconcile(ctx); err != nil {
+		ss.revokeAll(false)
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			ss.revokeAll(true)
+			return nil
+		case <-ss.session.Done():
+			ss.revokeAll(false)
+			return errors.New("session expired")
+		case wr, ok := <-wch:
+			if !ok || wr.Err() != nil {
+				ss.revokeAll(true)
+				return errors.New("watch fail")
+			}
+			for _, ev := range wr.Events {
+				ss.apply(ev.Type, ev.Kv)
+			}
+		case shard := <-ss.drainedC:
+			if err := ss.release(ctx, shard); err != nil {
+				ss.revokeAll(false)
+				return err
+			}
+		}
+		if err := ss.reconcile(ctx); err != nil {
+			ss.revokeAll(false)
+			return err
+		}
+	}
+}
+
+func (ss *shardSession) memberKey(id string) string {
+	return ss.keyPrefix + "/members/" + id
+}
+
+func (ss *shardSession) shardKey(shard int) string {
+	return ss.keyPrefix + "/shards/" + strconv.Itoa(shard)
+}
+
+// apply update view of members and shard holders
+func (ss *shardSession) apply(tp mvccpb.Event_EventType, kv *mvccpb.KeyValue) {
+	key := strings.TrimPrefix(string(kv.Key), ss.keyPrefix+"/")
+	if strings.HasPrefix(key, "members/") {
+		id := strings.TrimPrefix(key, "members/")
+		if tp == mvccpb.DELETE {
+			delete(ss.live, id)
+		} else {
+			ss.live[id] = true
+		}
+	} else if strings.HasPrefix(key, "shards/") {
+		shard, err := strconv.Atoi(strings.TrimPrefix(key, "shards/"))
+		if err != nil {
+			return
+		}
+		if tp == mvccpb.DELETE {
+			delete(ss.holders, shard)
+		} else {
+			ss.holders[shard] = string(kv.Value)
+		}
+	}
+}
+
+// reconcile revoke shards assigned to others and acquire free shards assigned to me
+func (ss *shardSession) reconcile(ctx context.Context) error {
+	members := make([]string, 0, len(ss.live))
+	for m := range ss.live {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	ss.Lock()
+	ss.members = members
+	ss.Unlock()
+	owners := ss.assign(members, ss.shards)
+	for shard, owner := range owners {
+		holder, held := ss.holders[shard]
+		if holder == ss.identity && owner != ss.identity && !ss.draining[shard] {
+			ss.draining[shard] = true
+			ss.setOwned(shard, false)
+			ss.emit(ShardEvent{Type: ShardRevoked, Shard: shard, done: ss.doneFunc(shard)})
+		} else if owner == ss.identity && !held {
+			ok, err := ss.acquire(ctx, shard)
+			if err != nil {
+				return err
+			}
+			if ok {
+				ss.setOwned(shard, true)
+				ss.emit(ShardEvent{Type: ShardAssigned, Shard: shard})
+			}
+		}
+	}
+	return nil
+}
+
+func (ss *shardSession) acquire(ctx context.Context, shard int) (bool, error) {
+	key := ss.shardKey(shard)
+	resp, err := ss.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, ss.identity, clientv3.WithLease(ss.session.Lease()))).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	if resp.Succeeded {
+		ss.holders[shard] = ss.identity
+	}
+	return resp.Succeeded, nil
+}
+
+func (ss *shardSession) release(ctx context.Context, shard int) error {
+	if !ss.draining[shard] {
+		return nil
+	}
+	key := ss.shardKey(shard)
+	_, err := ss.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", ss.identity)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	delete(ss.draining, shard)
+	delete(ss.holders, shard)
+	return nil
+}
+
+// revokeAll revoke all my shards, wait them drained and release them if wait
+func (ss *shardSession) revokeAll(wait bool) {
+	for shard, holder := range ss.holders {
+		if holder == ss.identity && !ss.draining[shard] {
+			ss.draining[shard] = true
+			ss.setOwned(shard, false)
+			if !ss.emit(ShardEvent{Type: ShardRevoked, Shard: shard, done: ss.doneFunc(shard)}) {
+				// nobody drains it, lease keys are removed when session closes
+				delete(ss.draining, shard)
+			}
+		}
+	}
+	if wait {
+		timeout := time.After(ss.drainTimeout)
+		for len(ss.draining) > 0 {
+			select {
+			case shard := <-ss.drainedC:
+				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+				ss.release(ctx, shard)
+				cancel()
+			case <-ss.session.Done():
+				wait = false
+			case <-timeout:
+				ss.logger.Errorf("[sharder]wait shards drained timeout")
+				wait = false
+			}
+			if !wait {
+				break
+			}
+		}
+	}
+	ss.Lock()
+	ss.owned = make(map[int]bool)
+	ss.Unlock()
+}
+
+func (ss *shardSession) setOwned(shard int, owned bool) {
+	ss.Lock()
+	if owned {
+		ss.owned[shard] = true
+	} else {
+		delete(ss.owned, shard)
+	}
+	ss.Unlock()
+}
+
+// emit send event, once sharder is exiting it gives up after drain timeout, so that Run returns
+// even if caller stops reading EventC
+func (ss *shardSession) emit(ev ShardEvent) bool {
+	ss.logger.Debugf("[sharder]shard %d %s", ev.Shard, ev.Type.String())
+	select {
+	case ss.eventC <- ev:
+		return true
+	case <-ss.exitC:
+	}
+	if ss.giveUpAt.IsZero() {
+		ss.giveUpAt = time.Now().Add(ss.drainTimeout)
+	}
+	timer := time.NewTimer(time.Until(ss.giveUpAt))
+	defer timer.Stop()
+	select {
+	case ss.eventC <- ev:
+		return true
+	case <-timer.C:
+		ss.logger.Errorf("[sharder]drop shard %d %s event, EventC is not drained", ev.Shard, ev.Type.String())
+		return false
+	}
+}
+
+func (ss *shardSession) doneFunc(shard int) func() {
+	once := new(sync.Once)
+	quitC := ss.quitC
+	return func() {
+		once.Do(func() {
+			select {
+			case ss.drainedC <- shard:
+			case <-quitC:
+			}
+		})
+	}
+}
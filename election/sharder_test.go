@@ -0,0 +1,104 @@
+package election
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type shardTracker struct {
+	sync.Mutex
+	owner map[int]string
+	t     *testing.T
+}
+
+func (st *shardTracker) consume(s *Sharder, id string, delay time.Duration) {
+	for ev := range s.EventC() {
+		st.Lock()
+		switch ev.Type {
+		case ShardAssigned:
+			if o, ok := st.owner[ev.Shard]; ok {
+				st.t.Errorf("shard %d assigned to %s while owned by %s", ev.Shard, id, o)
+			}
+			st.owner[ev.Shard] = id
+			st.Unlock()
+		case ShardRevoked:
+			st.Unlock()
+			go func(ev ShardEvent) {
+				time.Sleep(delay)
+				st.Lock()
+				delete(st.owner, ev.Shard)
+				st.Unlock()
+				ev.Done()
+			}(ev)
+		}
+	}
+}
+
+func (st *shardTracker) count(id string) int {
+	st.Lock()
+	defer st.Unlock()
+	n := 0
+	for _, o := range st.owner {
+		if o == id {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSharder(t *testing.T) {
+	ep, stop := startEtcd(t)
+	defer stop()
+	st := &shardTracker{owner: make(map[int]string), t: t}
+	n := 16
+	s1 := NewSharder([]string{ep}, "/shard", n).Identity("m1").TTL(2)
+	go st.consume(s1, "m1", 50*time.Millisecond)
+	go s1.Start()
+	waitUntil(t, "m1 should own all", func() bool { return st.count("m1") == n })
+	s2 := NewSharder([]string{ep}, "/shard", n).Identity("m2").TTL(2)
+	go st.consume(s2, "m2", 50*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() { errC <- s2.Run(ctx) }()
+	waitUntil(t, "should split", func() bool {
+		return st.count("m1")+st.count("m2") == n && st.count("m2") > 0 && st.count("m1") > 0 && len(s1.Shards())+len(s2.Shards()) == n
+	})
+	if len(s1.Members()) != 2 {
+		t.Fatal(s1.Members())
+	}
+	cancel()
+	if err := <-errC; err != context.Canceled {
+		t.Fatal(err)
+	}
+	if len(s2.Shards()) != 0 {
+		t.Fatal("s2 should release")
+	}
+	waitUntil(t, "m1 should own all again", func() bool { return st.count("m1") == n })
+	s1.Stop()
+	if st.count("m1") != 0 {
+		t.Fatal("should drained")
+	}
+}
+
+func TestSharderEventCNotDrained(t *testing.T) {
+	ep, stop := startEtcd(t)
+	defer stop()
+	s := NewSharder([]string{ep}, "/shard-blocked", 4).Identity("m1").TTL(2).DrainTimeout(200 * time.Millisecond)
+	// caller never reads events
+	s.eventC = make(chan ShardEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() { errC <- s.Run(ctx) }()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errC:
+		if err != context.Canceled {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run should return when EventC is not drained")
+	}
+}
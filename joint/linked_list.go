@@ -31,6 +31,17 @@ func (l *linkedList) push(v reflect.Value) {
 	}
 }
 
+func (l *linkedList) requeue(v reflect.Value) {
+	n := &node{
+		val:  v,
+		next: l.head,
+	}
+	l.head = n
+	if l.rear == nil {
+		l.rear = n
+	}
+}
+
 func (l *linkedList) pop() (reflect.Value, bool) {
 	if l.head == nil {
 		return reflect.Value{}, false
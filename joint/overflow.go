@@ -0,0 +1,99 @@
+package joint
+
+import (
+	"sync/atomic"
+)
+
+// OverflowPolicy what to do when buffer reaches Cap
+type OverflowPolicy int32
+
+const (
+	// Block stop reading readC until buffer has room
+	Block OverflowPolicy = iota
+	// DropOldest drop the oldest buffered value
+	DropOldest
+	// DropNewest drop the value just read
+	DropNewest
+)
+
+// Stats counters of pipe
+type Stats struct {
+	Enqueued       uint64 // values read into buffer
+	Dequeued       uint64 // values written to writeC
+	Dropped        uint64 // values dropped by overflow policy
+	Filtered       uint64 // values dropped by filter
+	Len            uint64 // current buffer length, spilled values included
+	HighWater      uint64 // max in-memory buffer length
+	SpillHighWater uint64 // max count of spilled values
+	SpillErrors    uint64 // spilled values lost by decode error
+}
+
+// SetOverflow set overflow policy, onDrop receives every dropped value if not nil; SpillPipe applies it only if
+// spilling fails, with Block the failed value is still buffered and reading stops until buffer has room.
+// For PriorityPipe and DelayPipe both DropOldest and DropNewest drop the value of lowest priority(or latest due),
+// which is the new value if it's not before any buffered value
+func (j *Joint) SetOverflow(policy OverflowPolicy, onDrop func(interface{})) {
+	j.onDrop.Store(dropHook{fn: onDrop})
+	atomic.StoreInt32(&j.policy, int32(policy))
+}
+
+// dropHook wrap onDrop for atomic.Value which can't store nil
+type dropHook struct {
+	fn func(interface{})
+}
+
+// Stats return counters of pipe
+func (j *Joint) Stats() Stats {
+	return Stats{
+		Enqueued:       atomic.LoadUint64(&j.stats.Enqueued),
+		Dequeued:       atomic.LoadUint64(&j.stats.Dequeued),
+		Dropped:        atomic.LoadUint64(&j.stats.Dropped),
+		Filtered:       atomic.LoadUint64(&j.stats.Filtered),
+		Len:            j.Len(),
+		HighWater:      atomic.LoadUint64(&j.stats.HighWater),
+		SpillHighWater: atomic.LoadUint64(&j.stats.SpillHighWater),
+		SpillErrors:    atomic.LoadUint64(&j.stats.SpillErrors),
+	}
+}
+
+func (j *Joint) overflowPolicy() OverflowPolicy {
+	return OverflowPolicy(atomic.LoadInt32(&j.policy))
+}
+
+func (j *Joint) countEnqueue() {
+	atomic.AddUint64(&j.stats.Enqueued, 1)
+	j.markHighWater()
+}
+
+func (j *Joint) markHighWater() {
+	if j.queueSize > atomic.LoadUint64(&j.stats.HighWater) {
+		atomic.StoreUint64(&j.stats.HighWater, j.queueSize)
+	}
+}
+
+func (j *Joint) countSpill() {
+	atomic.AddUint64(&j.stats.Enqueued, 1)
+	if n := j.Spilled(); n > atomic.LoadUint64(&j.stats.SpillHighWater) {
+		atomic.StoreUint64(&j.stats.SpillHighWater, n)
+	}
+}
+
+// countDrop call onDrop before counting, so that onDrop is done once Dropped is seen
+func (j *Joint) countDrop(v interface{}) {
+	if hook, ok := j.onDrop.Load().(dropHook); ok && hook.fn != nil {
+		hook.fn(v)
+	}
+	atomic.AddUint64(&j.stats.Dropped, 1)
+}
+
+func (j *Joint) countSpillError() {
+	atomic.AddUint64(&j.stats.SpillErrors, 1)
+}
+
+func (j *Joint) countDequeue() {
+	atomic.AddUint64(&j.stats.Dequeued, 1)
+}
+
+func (j *Joint) countFilter() {
+	atomic.AddUint64(&j.stats.Filtered, 1)
+}
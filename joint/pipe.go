@@ -7,6 +7,7 @@ import (
 	"math"
 	"reflect"
 	"sync/atomic"
+	"time"
 )
 
 // Debug would print enquue/dequeue information
@@ -17,17 +18,30 @@ type PipeFilter func(interface{}) bool
 
 // Joint connect two channel
 type Joint struct {
-	list            *linkedList
+	stats           Stats // keep first for 64-bit atomic alignment
+	list            buffer
 	readC, writeC   reflect.Value
 	breakC, reloadC chan struct{}
 	broken          int32
+	drained         int32 // input closed and buffer drained
 	maxIn           uint64
 	queueSize       uint64
 	filter          PipeFilter
+	policy          int32
+	onDrop          atomic.Value // dropHook
+	less            func(a, b interface{}) bool
+	due             func(interface{}) time.Time
+	spill           Spiller
+	codec           Codec
+	spilled         uint64
 }
 
 // Pipe two channel
 func Pipe(readC interface{}, writeC interface{}) (*Joint, error) {
+	return pipe(readC, writeC, nil)
+}
+
+func pipe(readC interface{}, writeC interface{}, init func(*Joint)) (*Joint, error) {
 	if readC == nil || writeC == nil {
 		return nil, errors.New("data channel should not be nil")
 	}
@@ -43,6 +57,9 @@ func Pipe(readC interface{}, writeC interface{}) (*Joint, error) {
 		list:    newList(),
 		maxIn:   math.MaxUint64 - 1,
 	}
+	if init != nil {
+		init(j)
+	}
 	go j.transport()
 	return j, nil
 }
@@ -73,9 +90,9 @@ func (j *Joint) SetCap(l uint64) error {
 	return nil
 }
 
-// Len return buffer length
+// Len return buffer length, spilled values included
 func (j *Joint) Len() uint64 {
-	return j.queueSize
+	return atomic.LoadUint64(&j.queueSize) + j.Spilled()
 }
 
 // Cap return pipe cap
@@ -1,9 +1,17 @@
 package joint
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/xujiajun/nutsdb"
 )
 
 func TestSimplePipe(t *testing.T) {
@@ -230,3 +238,416 @@ func TestFilter(t *testing.T) {
 		}
 	}
 }
+
+func TestFileSpillerCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "joint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fs, err := NewFileSpiller(filepath.Join(dir, "spill"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	fs.compactAt = 1024
+	// never drained, one value is always left
+	fs.Push([]byte("0"))
+	for i := 1; i < 10000; i++ {
+		fs.Push([]byte(strconv.Itoa(i)))
+		data, err := fs.Pop()
+		if err != nil || string(data) != strconv.Itoa(i-1) {
+			t.Fatalf("pop %s %v, expect %d", data, err, i-1)
+		}
+	}
+	if info, _ := fs.file.Stat(); info.Size() > 2048 {
+		t.Fatalf("file should be compacted, size %d", info.Size())
+	}
+	if data, _ := fs.Pop(); string(data) != "9999" || fs.Len() != 0 {
+		t.Fatalf("bad last value %s", data)
+	}
+}
+
+func TestSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "joint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileStore, err := NewFileSpiller(filepath.Join(dir, "spill"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileStore.Close()
+	opt := nutsdb.DefaultOptions
+	opt.Dir = filepath.Join(dir, "nuts")
+	db, err := nutsdb.Open(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type Job struct {
+		ID int
+	}
+	for _, store := range []Spiller{fileStore, NewNutsSpiller(db, "joint", "jobs")} {
+		in, out := make(chan Job), make(chan Job)
+		pipe, err := SpillPipe(in, out, store, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pipe.SetCap(5)
+		pipe.SetFilter(func(v interface{}) bool { return v.(Job).ID%10 != 9 })
+		size := 100
+		for i := 0; i < size; i++ {
+			select {
+			case in <- Job{ID: i}:
+			case <-time.After(time.Second):
+				t.Fatal("should not blocked")
+			}
+		}
+		// the last value may be still in scheduler, values are filtered on pop
+		for i := 0; i < 100 && pipe.Len() != 100; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if pipe.Spilled() == 0 || pipe.Len() != 100 {
+			t.Fatalf("spilled %d len %d", pipe.Spilled(), pipe.Len())
+		}
+		for i := 0; i < size; i++ {
+			if i%10 == 9 {
+				continue
+			}
+			if job := <-out; job.ID != i {
+				t.Fatalf("bad sequence %d, expect %d", job.ID, i)
+			}
+		}
+		if pipe.Spilled() != 0 || store.Len() != 0 {
+			t.Fatal("should be drained")
+		}
+		// the last filtered value is popped after the last write
+		for i := 0; i < 100 && pipe.Stats().Filtered != 10; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if stats := pipe.Stats(); stats.Filtered != 10 || stats.Enqueued != 100 {
+			t.Fatalf("values should be filtered once %+v", stats)
+		}
+		pipe.Breakoff()
+	}
+}
+
+// memSpiller in-memory spiller, Push fails if full is set
+type memSpiller struct {
+	list [][]byte
+	full int32
+	*sync.Mutex
+}
+
+func (m *memSpiller) Push(data []byte) error {
+	if atomic.LoadInt32(&m.full) == 1 {
+		return fmt.Errorf("store is full")
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.list = append(m.list, data)
+	return nil
+}
+
+func (m *memSpiller) Pop() ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+	data := m.list[0]
+	m.list = m.list[1:]
+	return data, nil
+}
+
+func (m *memSpiller) Len() uint64 {
+	m.Lock()
+	defer m.Unlock()
+	return uint64(len(m.list))
+}
+
+// badCodec fail to decode "bad"
+type badCodec struct{ JSONCodec }
+
+func (c badCodec) Decode(data []byte, v interface{}) error {
+	if string(data) == `"bad"` {
+		return fmt.Errorf("bad data")
+	}
+	return c.JSONCodec.Decode(data, v)
+}
+
+func TestSpillErrors(t *testing.T) {
+	store := &memSpiller{full: 1, Mutex: new(sync.Mutex)}
+	in, out := make(chan string), make(chan string)
+	pipe, err := SpillPipe(in, out, store, badCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Breakoff()
+	pipe.SetCap(2)
+	pipe.SetOverflow(DropNewest, nil)
+	// store fails, overflow policy applies
+	for _, v := range []string{"a", "b", "c"} {
+		in <- v
+	}
+	for i := 0; i < 100 && pipe.Stats().Dropped != 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := pipe.Stats(); stats.Dropped != 1 || stats.Len != 2 {
+		t.Fatalf("failed spill should be dropped by policy %+v", stats)
+	}
+	atomic.StoreInt32(&store.full, 0)
+	for _, v := range []string{"bad", "d"} {
+		in <- v
+	}
+	var list []string
+	for i := 0; i < 3; i++ {
+		list = append(list, <-out)
+	}
+	if fmt.Sprint(list) != "[a b d]" {
+		t.Fatalf("got %v", list)
+	}
+	if stats := pipe.Stats(); stats.SpillErrors != 1 {
+		t.Fatalf("decode error should be counted %+v", stats)
+	}
+}
+
+func TestMergeAndSplit(t *testing.T) {
+	in1, in2, merged := make(chan int), make(chan int), make(chan int)
+	pipe, err := Merge(merged, in1, in2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipe.SetFilter(func(v interface{}) bool { return v.(int) >= 0 })
+	outs := []chan int{make(chan int, 100), make(chan int, 100)}
+	if _, err = Split(merged, outs[0], outs[1]); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 0; i < 50; i++ {
+			in1 <- i
+			in1 <- -1
+		}
+		close(in1)
+	}()
+	go func() {
+		for i := 50; i < 100; i++ {
+			in2 <- i
+		}
+		close(in2)
+	}()
+	<-pipe.DoneC()
+	seen := make(map[int]bool)
+	timeout := time.After(time.Second)
+	for len(seen) < 100 {
+		select {
+		case v := <-outs[0]:
+			seen[v] = true
+		case v := <-outs[1]:
+			seen[v] = true
+		case <-timeout:
+			t.Fatalf("got %d values", len(seen))
+		}
+	}
+	if len(outs[0]) != 0 || len(outs[1]) != 0 || seen[-1] {
+		t.Fatal("unexpected value")
+	}
+
+	in, a, b := make(chan int), make(chan int, 10), make(chan int, 10)
+	pipe, _ = SplitByKey(in, func(v interface{}) string { return strconv.Itoa(v.(int) % 2) }, a, b)
+	for i := 0; i < 10; i++ {
+		in <- i
+	}
+	close(in)
+	<-pipe.DoneC()
+	time.Sleep(time.Millisecond)
+	if len(a)+len(b) != 10 {
+		t.Fatal("lost data")
+	}
+	for _, c := range []chan int{a, b} {
+		first := <-c
+		for len(c) > 0 {
+			if v := <-c; v%2 != first%2 {
+				t.Fatal("same key should go to same channel")
+			}
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	in, out := make(chan int), make(chan string, 100)
+	pipe, err := Map(in, out, 4, func(v interface{}) interface{} {
+		return strconv.Itoa(v.(int) * 2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		in <- i
+	}
+	close(in)
+	<-pipe.DoneC()
+	time.Sleep(time.Millisecond)
+	seen := make(map[string]bool)
+	for len(out) > 0 {
+		seen[<-out] = true
+	}
+	if len(seen) != 50 || !seen["98"] {
+		t.Fatalf("got %v", seen)
+	}
+
+	in, words := make(chan int), make(chan int, 100)
+	pipe, _ = FlatMap(in, words, 1, func(v interface{}) []interface{} {
+		var list []interface{}
+		for i := 0; i < v.(int); i++ {
+			list = append(list, v)
+		}
+		return list
+	})
+	for i := 0; i < 4; i++ {
+		in <- i
+	}
+	close(in)
+	<-pipe.DoneC()
+	time.Sleep(time.Millisecond)
+	var list []int
+	for len(words) > 0 {
+		list = append(list, <-words)
+	}
+	if fmt.Sprint(list) != "[1 2 2 3 3 3]" {
+		t.Fatalf("got %v", list)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	for _, c := range []struct {
+		policy   OverflowPolicy
+		expect   string
+		enqueued uint64
+	}{
+		{DropNewest, "[0 1 2]", 3},
+		{DropOldest, "[7 8 9]", 10},
+	} {
+		in, out := make(chan int), make(chan int)
+		pipe, err := Pipe(in, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dropped []int
+		pipe.SetOverflow(c.policy, func(v interface{}) { dropped = append(dropped, v.(int)) })
+		pipe.SetFilter(func(v interface{}) bool { return v.(int) >= 0 })
+		pipe.SetCap(3)
+		in <- -1
+		for i := 0; i < 10; i++ {
+			select {
+			case in <- i:
+			case <-time.After(time.Second):
+				t.Fatal("should not blocked")
+			}
+		}
+		for i := 0; i < 100 && pipe.Stats().Dropped != 7; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		var list []int
+		for i := 0; i < 3; i++ {
+			list = append(list, <-out)
+		}
+		if fmt.Sprint(list) != c.expect || len(dropped) != 7 {
+			t.Fatalf("%v got %v, dropped %v", c.policy, list, dropped)
+		}
+		for i := 0; i < 100 && pipe.Stats().Dequeued != 3; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		stats := pipe.Stats()
+		if stats.Enqueued != c.enqueued || stats.Dequeued != 3 || stats.Dropped != 7 || stats.Filtered != 1 || stats.HighWater != 3 || stats.Len != 0 {
+			t.Fatalf("bad stats %+v", stats)
+		}
+		pipe.Breakoff()
+	}
+}
+
+func TestPriority(t *testing.T) {
+	type Job struct {
+		ID       int
+		Priority int64
+	}
+	in, out := make(chan Job), make(chan Job)
+	pipe, err := PriorityPipeBy(in, out, func(v interface{}) int64 { return v.(Job).Priority })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Breakoff()
+	for i, p := range []int64{1, 3, 2, 3, 5, 1} {
+		in <- Job{ID: i, Priority: p}
+	}
+	for i := 0; i < 100 && pipe.Len() != 6; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	var ids []int
+	for i := 0; i < 6; i++ {
+		ids = append(ids, (<-out).ID)
+	}
+	if fmt.Sprint(ids) != "[4 1 3 2 0 5]" {
+		t.Fatalf("got %v", ids)
+	}
+}
+
+func TestPriorityOverflow(t *testing.T) {
+	run := func(policy OverflowPolicy, cap uint64, input []int, n int) (out, dropped []int) {
+		in, outC := make(chan int), make(chan int)
+		pipe, _ := PriorityPipeBy(in, outC, func(v interface{}) int64 { return int64(v.(int)) })
+		defer pipe.Breakoff()
+		pipe.SetCap(cap)
+		pipe.SetOverflow(policy, func(v interface{}) { dropped = append(dropped, v.(int)) })
+		for _, v := range input {
+			in <- v
+		}
+		for i := 0; i < n; i++ {
+			out = append(out, <-outC)
+		}
+		return
+	}
+	// the lowest priority is dropped instead of the pending best one
+	if out, dropped := run(DropOldest, 3, []int{1, 100, 2, 3}, 3); fmt.Sprint(out, dropped) != "[100 3 2] [1]" {
+		t.Fatal(out, dropped)
+	}
+	if out, dropped := run(DropNewest, 3, []int{1, 100, 2, 0}, 3); fmt.Sprint(out, dropped) != "[100 2 1] [0]" {
+		t.Fatal(out, dropped)
+	}
+	if out, dropped := run(DropOldest, 1, []int{1, 5, 3}, 1); fmt.Sprint(out, dropped) != "[5] [1 3]" {
+		t.Fatal(out, dropped)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	type Retry struct {
+		ID  int
+		Due time.Time
+	}
+	in, out := make(chan Retry), make(chan Retry)
+	pipe, err := DelayPipe(in, out, func(v interface{}) time.Time { return v.(Retry).Due })
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, d := range []int{60, 20, 0, 40} {
+		in <- Retry{ID: i, Due: now.Add(time.Duration(d) * time.Millisecond)}
+	}
+	close(in)
+	var ids []int
+	for i := 0; i < 4; i++ {
+		r := <-out
+		if time.Now().Before(r.Due) {
+			t.Fatalf("%d is not due", r.ID)
+		}
+		ids = append(ids, r.ID)
+	}
+	if fmt.Sprint(ids) != "[2 1 3 0]" {
+		t.Fatalf("got %v", ids)
+	}
+	select {
+	case <-pipe.DoneC():
+	case <-time.After(time.Second):
+		t.Fatal("pipe should end after drained")
+	}
+}
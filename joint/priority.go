@@ -0,0 +1,123 @@
+package joint
+
+import (
+	"container/heap"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// buffer of pipe
+type buffer interface {
+	push(v reflect.Value)
+	pop() (reflect.Value, bool)
+	// requeue put back a popped value, before values of the same order
+	requeue(v reflect.Value)
+}
+
+// PriorityPipe pipe two channel, buffered values are written by order of less, values of the same order are fifo
+func PriorityPipe(readC interface{}, writeC interface{}, less func(a, b interface{}) bool) (*Joint, error) {
+	if less == nil {
+		return nil, errors.New("less func should not be nil")
+	}
+	return pipe(readC, writeC, func(j *Joint) {
+		j.less, j.list = less, newHeap(less)
+	})
+}
+
+// PriorityPipeBy pipe two channel, buffered values of higher priority are written first
+func PriorityPipeBy(readC interface{}, writeC interface{}, priority func(interface{}) int64) (*Joint, error) {
+	if priority == nil {
+		return nil, errors.New("priority func should not be nil")
+	}
+	return PriorityPipe(readC, writeC, func(a, b interface{}) bool {
+		return priority(a) > priority(b)
+	})
+}
+
+// DelayPipe pipe two channel, values are held until due(v) and written by due time
+func DelayPipe(readC interface{}, writeC interface{}, due func(interface{}) time.Time) (*Joint, error) {
+	if due == nil {
+		return nil, errors.New("due func should not be nil")
+	}
+	less := func(a, b interface{}) bool {
+		return due(a).Before(due(b))
+	}
+	return pipe(readC, writeC, func(j *Joint) {
+		j.less, j.due, j.list = less, due, newHeap(less)
+	})
+}
+
+type heapItem struct {
+	val reflect.Value
+	seq int64
+}
+
+type heapBuffer struct {
+	items []heapItem
+	less  func(a, b interface{}) bool
+	seq   int64 // seq of pushed values, increasing
+	front int64 // seq of requeued values, decreasing
+}
+
+func newHeap(less func(a, b interface{}) bool) *heapBuffer {
+	return &heapBuffer{less: less}
+}
+
+func (h *heapBuffer) push(v reflect.Value) {
+	h.seq++
+	heap.Push(h, heapItem{val: v, seq: h.seq})
+}
+
+func (h *heapBuffer) requeue(v reflect.Value) {
+	h.front--
+	heap.Push(h, heapItem{val: v, seq: h.front})
+}
+
+func (h *heapBuffer) pop() (reflect.Value, bool) {
+	if len(h.items) == 0 {
+		return reflect.Value{}, false
+	}
+	return heap.Pop(h).(heapItem).val, true
+}
+
+// lastIndex index of the value popped last, -1 if empty
+func (h *heapBuffer) lastIndex() int {
+	if len(h.items) == 0 {
+		return -1
+	}
+	// the last one is a leaf
+	last := len(h.items) / 2
+	for i := last + 1; i < len(h.items); i++ {
+		if h.Less(last, i) {
+			last = i
+		}
+	}
+	return last
+}
+
+// heap.Interface
+
+func (h *heapBuffer) Len() int { return len(h.items) }
+
+func (h *heapBuffer) Less(i, j int) bool {
+	a, b := h.items[i].val.Interface(), h.items[j].val.Interface()
+	if h.less(a, b) {
+		return true
+	} else if h.less(b, a) {
+		return false
+	}
+	return h.items[i].seq < h.items[j].seq
+}
+
+func (h *heapBuffer) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *heapBuffer) Push(x interface{}) { h.items = append(h.items, x.(heapItem)) }
+
+func (h *heapBuffer) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = heapItem{}
+	h.items = h.items[:n-1]
+	return item
+}
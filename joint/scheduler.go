@@ -1,6 +1,7 @@
 package joint
 
 import (
+	"container/heap"
 	"log"
 	"reflect"
 	"sync/atomic"
@@ -26,6 +27,7 @@ type scheduler struct {
 	lastD                interface{}   // last dequeue value
 	aborted              bool
 	inputClosed          bool
+	spillFailed          bool // last spill failed, read is blocked by Block policy while buffer is full
 }
 
 func newScheduler(j *Joint) *scheduler {
@@ -65,14 +67,14 @@ func newScheduler(j *Joint) *scheduler {
 	}
 }
 
-func (s *scheduler) resetTimer() {
+func (s *scheduler) resetTimer(d time.Duration) {
 	if !s.timer.Stop() {
 		select {
 		case <-s.timer.C:
 		default:
 		}
 	}
-	s.timer.Reset(s.term)
+	s.timer.Reset(d)
 }
 
 func (s *scheduler) stop() {
@@ -82,7 +84,8 @@ func (s *scheduler) stop() {
 func (s *scheduler) isAborted() bool { return s.aborted }
 
 func (s *scheduler) runOnce() {
-	s.resetTimer()
+	s.resetTimer(s.term)
+	s.refill()
 	if s.Joint.queueSize == 0 {
 		s.waitRead()
 	} else {
@@ -92,12 +95,16 @@ func (s *scheduler) runOnce() {
 
 func (s *scheduler) waitRead() {
 	if s.inputClosed {
+		atomic.StoreInt32(&s.Joint.drained, 1)
 		s.aborted = true
 		return
 	}
 	// list is empty
 	chosen, recv, ok := reflect.Select(s.readChannels)
 	if !ok {
+		if chosen == readI {
+			atomic.StoreInt32(&s.Joint.drained, 1)
+		}
 		s.aborted = true
 		return
 	}
@@ -107,9 +114,11 @@ func (s *scheduler) waitRead() {
 	dataVal := recv.Interface()
 	// drop data by filter
 	if s.Joint.filter != nil && !s.Joint.filter(dataVal) {
+		s.Joint.countFilter()
 		return
 	}
-	s.Joint.queueSize++
+	atomic.AddUint64(&s.Joint.queueSize, 1)
+	s.Joint.countEnqueue()
 	s.readAndWriteChannels[writeI].Send = recv
 	if Debug {
 		s.lastE = recv.Interface()
@@ -133,7 +142,17 @@ func (s *scheduler) waiteReadOrWrite() {
 }
 
 func (s *scheduler) tryReadOrWrite() (chosen int, recv reflect.Value, ok bool) {
-	if buff := atomic.LoadUint64(&s.Joint.maxIn); s.Joint.queueSize >= buff {
+	if s.Joint.due != nil {
+		// hold write until the next value is due, timer wakes scheduler up
+		if wait := time.Until(s.Joint.due(s.readAndWriteChannels[writeI].Send.Interface())); wait > 0 {
+			if wait < s.term {
+				s.resetTimer(wait)
+			}
+			s.readAndWriteChannels[writeI].Chan = reflect.Value{}
+			defer func() { s.readAndWriteChannels[writeI].Chan = s.Joint.writeC }()
+		}
+	}
+	if buff := atomic.LoadUint64(&s.Joint.maxIn); s.Joint.queueSize >= buff && (s.Joint.spill == nil || s.spillFailed) && s.Joint.overflowPolicy() == Block {
 		// block read channel
 		s.readAndWriteChannels[readI].Chan = s.dummyC
 		chosen, recv, ok = reflect.Select(s.readAndWriteChannels)
@@ -149,7 +168,8 @@ func (s *scheduler) prepareNextWrite() {
 	for s.Joint.queueSize > 0 {
 		val, _ := s.Joint.list.pop()
 		if s.Joint.filter != nil && !s.Joint.filter(val.Interface()) {
-			s.Joint.queueSize--
+			atomic.AddUint64(&s.Joint.queueSize, ^uint64(0))
+			s.Joint.countFilter()
 		} else {
 			s.readAndWriteChannels[writeI].Send = val
 			if Debug {
@@ -161,7 +181,8 @@ func (s *scheduler) prepareNextWrite() {
 }
 
 func (s *scheduler) handleSend(chosen int, recv reflect.Value) {
-	s.Joint.queueSize--
+	atomic.AddUint64(&s.Joint.queueSize, ^uint64(0))
+	s.Joint.countDequeue()
 	if Debug {
 		log.Printf("[joint] Dequeue %v", s.lastD)
 	}
@@ -185,12 +206,133 @@ func (s *scheduler) handleRecv(chosen int, recv reflect.Value, ok bool) {
 		}
 	}
 	if chosen == readI {
-		// read ok
-		s.Joint.list.push(recv)
-		s.Joint.queueSize++
+		// read ok, keep order by spilling while there are spilled values, values are filtered on pop
+		full := s.Joint.queueSize >= atomic.LoadUint64(&s.Joint.maxIn)
+		if s.Joint.spill != nil && (s.Joint.Spilled() > 0 || full) {
+			if s.spillFailed = !s.spillOut(recv); !s.spillFailed {
+				return
+			}
+		}
+		if full && !s.overflow(recv) {
+			return
+		}
+		s.push(recv)
+		atomic.AddUint64(&s.Joint.queueSize, 1)
+		s.Joint.countEnqueue()
 		if Debug {
 			s.lastE = recv.Interface()
 			log.Printf("[joint] Enqueue %v", s.lastE)
 		}
 	}
 }
+
+// push buffer value, for priority buffer the value may go before the one waiting to be written
+func (s *scheduler) push(val reflect.Value) {
+	if next := s.readAndWriteChannels[writeI].Send; s.Joint.less != nil && s.Joint.less(val.Interface(), next.Interface()) {
+		s.Joint.list.requeue(next)
+		s.readAndWriteChannels[writeI].Send = val
+		if Debug {
+			s.lastD = val.Interface()
+		}
+		return
+	}
+	s.Joint.list.push(val)
+}
+
+// overflow apply overflow policy when buffer is full, return whether val should be buffered
+func (s *scheduler) overflow(val reflect.Value) bool {
+	policy := s.Joint.overflowPolicy()
+	if s.Joint.less != nil && policy != Block {
+		return s.dropLowest(val)
+	}
+	switch policy {
+	case DropNewest:
+		s.Joint.countDrop(val.Interface())
+		return false
+	case DropOldest:
+		// the oldest value is the one waiting to be written
+		s.Joint.countDrop(s.readAndWriteChannels[writeI].Send.Interface())
+		atomic.AddUint64(&s.Joint.queueSize, ^uint64(0))
+		s.prepareNextWrite()
+		if s.Joint.queueSize == 0 {
+			s.readAndWriteChannels[writeI].Send = val
+			atomic.AddUint64(&s.Joint.queueSize, 1)
+			s.Joint.countEnqueue()
+			return false
+		}
+	}
+	return true
+}
+
+// dropLowest drop the value written last among buffered values and val, return whether val should be buffered
+func (s *scheduler) dropLowest(val reflect.Value) bool {
+	h := s.Joint.list.(*heapBuffer)
+	i := h.lastIndex()
+	lowest := s.readAndWriteChannels[writeI].Send
+	if i >= 0 {
+		lowest = h.items[i].val
+	}
+	if !s.Joint.less(val.Interface(), lowest.Interface()) {
+		s.Joint.countDrop(val.Interface())
+		return false
+	}
+	s.Joint.countDrop(lowest.Interface())
+	if i < 0 {
+		// only the value waiting to be written is buffered
+		s.readAndWriteChannels[writeI].Send = val
+		s.Joint.countEnqueue()
+		return false
+	}
+	heap.Remove(h, i)
+	atomic.AddUint64(&s.Joint.queueSize, ^uint64(0))
+	return true
+}
+
+// spillOut push value to spill store
+func (s *scheduler) spillOut(val reflect.Value) bool {
+	data, err := s.Joint.codec.Encode(val.Interface())
+	if err == nil {
+		err = s.Joint.spill.Push(data)
+	}
+	if err != nil {
+		log.Printf("[joint] spill %v fail:%v", val.Interface(), err)
+		return false
+	}
+	atomic.AddUint64(&s.Joint.spilled, 1)
+	s.Joint.countSpill()
+	if Debug {
+		log.Printf("[joint] Spill %v", val.Interface())
+	}
+	return true
+}
+
+// refill move spilled values back to buffer while it has room
+func (s *scheduler) refill() {
+	for s.Joint.spill != nil && s.Joint.Spilled() > 0 && s.Joint.queueSize < atomic.LoadUint64(&s.Joint.maxIn) {
+		data, err := s.Joint.spill.Pop()
+		if err != nil {
+			// give up spilling, values left in store are kept
+			log.Printf("[joint] read spilled value fail:%v", err)
+			s.Joint.spill = nil
+			atomic.StoreUint64(&s.Joint.spilled, 0)
+			return
+		}
+		atomic.AddUint64(&s.Joint.spilled, ^uint64(0))
+		val := reflect.New(s.Joint.readC.Type().Elem())
+		if err = s.Joint.codec.Decode(data, val.Interface()); err != nil {
+			log.Printf("[joint] decode spilled value fail:%v", err)
+			s.Joint.countSpillError()
+			continue
+		}
+		s.Joint.list.push(val.Elem())
+		atomic.AddUint64(&s.Joint.queueSize, 1)
+		s.Joint.markHighWater()
+		if Debug {
+			log.Printf("[joint] Refill %v", val.Elem().Interface())
+		}
+		// same as buffered values, the value to write is popped and filtered
+		if s.Joint.queueSize == 1 {
+			s.prepareNextWrite()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package joint
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/qjpcpu/common/json"
+	"github.com/xujiajun/nutsdb"
+)
+
+// Codec encode/decode spilled values
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	// Decode into pointer v
+	Decode(data []byte, v interface{}) error
+}
+
+// JSONCodec json codec
+type JSONCodec struct{}
+
+// Encode value
+func (JSONCodec) Encode(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+// Decode value
+func (JSONCodec) Decode(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// Spiller fifo store for values overflowing pipe buffer
+type Spiller interface {
+	Push(data []byte) error
+	// Pop the oldest value, only called when Len > 0
+	Pop() ([]byte, error)
+	Len() uint64
+}
+
+// SpillPipe pipe two channel, when buffer reaches Cap values spill to store instead of blocking readC,
+// and they are drained in order; codec is JSONCodec if nil.
+// Values left in store on Breakoff are kept, and are drained first when store is piped again.
+func SpillPipe(readC interface{}, writeC interface{}, store Spiller, codec Codec) (*Joint, error) {
+	if store == nil {
+		return nil, errors.New("spill store should not be nil")
+	}
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return pipe(readC, writeC, func(j *Joint) {
+		j.spill, j.codec, j.spilled = store, codec, store.Len()
+	})
+}
+
+// Spilled return count of values in spill store
+func (j *Joint) Spilled() uint64 {
+	return atomic.LoadUint64(&j.spilled)
+}
+
+// compact file of FileSpiller once popped data reaches it and is more than unpopped data
+const fileSpillerCompactSize = 4 << 20
+
+// FileSpiller spill to local file, the file is truncated once drained,
+// and compacted by moving unpopped data to head when it's mostly popped data
+type FileSpiller struct {
+	file      *os.File
+	readOff   int64
+	writeOff  int64
+	count     uint64
+	compactAt int64
+	*sync.Mutex
+}
+
+// NewFileSpiller create or truncate file at path
+func NewFileSpiller(path string) (*FileSpiller, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSpiller{file: file, compactAt: fileSpillerCompactSize, Mutex: new(sync.Mutex)}, nil
+}
+
+// Push append data
+func (fs *FileSpiller) Push(data []byte) error {
+	fs.Lock()
+	defer fs.Unlock()
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	if _, err := fs.file.WriteAt(buf, fs.writeOff); err != nil {
+		return err
+	}
+	fs.writeOff += int64(len(buf))
+	fs.count++
+	return nil
+}
+
+// Pop the oldest data
+func (fs *FileSpiller) Pop() ([]byte, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	if fs.count == 0 {
+		return nil, io.EOF
+	}
+	head := make([]byte, 4)
+	if _, err := fs.file.ReadAt(head, fs.readOff); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(head))
+	if _, err := fs.file.ReadAt(data, fs.readOff+4); err != nil {
+		return nil, err
+	}
+	fs.readOff += int64(4 + len(data))
+	if fs.count--; fs.count == 0 {
+		fs.readOff, fs.writeOff = 0, 0
+		fs.file.Truncate(0)
+	} else if fs.readOff >= fs.compactAt && fs.readOff >= fs.writeOff-fs.readOff {
+		// unpopped data fits before readOff, so it's intact if compact fails
+		fs.compact()
+	}
+	return data, nil
+}
+
+// compact move unpopped data to head of file and truncate the rest
+func (fs *FileSpiller) compact() error {
+	buf := make([]byte, 32<<10)
+	var off int64
+	for src := fs.readOff; src < fs.writeOff; {
+		n := len(buf)
+		if left := fs.writeOff - src; left < int64(n) {
+			n = int(left)
+		}
+		if _, err := fs.file.ReadAt(buf[:n], src); err != nil {
+			return err
+		}
+		if _, err := fs.file.WriteAt(buf[:n], off); err != nil {
+			return err
+		}
+		src += int64(n)
+		off += int64(n)
+	}
+	if err := fs.file.Truncate(off); err != nil {
+		return err
+	}
+	fs.readOff, fs.writeOff = 0, off
+	return nil
+}
+
+// Len count of data
+func (fs *FileSpiller) Len() uint64 {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.count
+}
+
+// Close close and remove file
+func (fs *FileSpiller) Close() error {
+	fs.file.Close()
+	return os.Remove(fs.file.Name())
+}
+
+// NutsSpiller spill to nutsdb list, data survives restart
+type NutsSpiller struct {
+	db     *nutsdb.DB
+	bucket string
+	key    []byte
+	count  uint64
+	*sync.Mutex
+}
+
+// NewNutsSpiller spill to list bucket/key of db
+func NewNutsSpiller(db *nutsdb.DB, bucket, key string) *NutsSpiller {
+	ns := &NutsSpiller{db: db, bucket: bucket, key: []byte(key), Mutex: new(sync.Mutex)}
+	db.View(func(tx *nutsdb.Tx) error {
+		if size, err := tx.LSize(bucket, ns.key); err == nil && size > 0 {
+			ns.count = uint64(size)
+		}
+		return nil
+	})
+	return ns
+}
+
+// Push append data
+func (ns *NutsSpiller) Push(data []byte) error {
+	ns.Lock()
+	defer ns.Unlock()
+	if err := ns.db.Update(func(tx *nutsdb.Tx) error {
+		return tx.RPush(ns.bucket, ns.key, data)
+	}); err != nil {
+		return err
+	}
+	ns.count++
+	return nil
+}
+
+// Pop the oldest data
+func (ns *NutsSpiller) Pop() (data []byte, err error) {
+	ns.Lock()
+	defer ns.Unlock()
+	if err = ns.db.Update(func(tx *nutsdb.Tx) error {
+		data, err = tx.LPop(ns.bucket, ns.key)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	ns.count--
+	return data, nil
+}
+
+// Len count of data
+func (ns *NutsSpiller) Len() uint64 {
+	ns.Lock()
+	defer ns.Unlock()
+	return ns.count
+}
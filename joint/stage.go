@@ -0,0 +1,187 @@
+package joint
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Merge pipe many read channels into writeC, pipe ends after all read channels are closed
+func Merge(writeC interface{}, readCs ...interface{}) (*Joint, error) {
+	if len(readCs) == 0 {
+		return nil, errors.New("no read channel")
+	}
+	var rvs []reflect.Value
+	for _, readC := range readCs {
+		if readC == nil || writeC == nil {
+			return nil, errors.New("data channel should not be nil")
+		}
+		rv, _, err := checkChan(readC, writeC)
+		if err != nil {
+			return nil, err
+		}
+		rvs = append(rvs, rv)
+	}
+	return stage(rvs, writeC, 1, func(v reflect.Value) []reflect.Value {
+		return []reflect.Value{v}
+	})
+}
+
+// Map pipe fn(v) of values from readC into writeC by workers goroutines, values are out of order if workers > 1
+func Map(readC interface{}, writeC interface{}, workers int, fn func(interface{}) interface{}) (*Joint, error) {
+	return FlatMap(readC, writeC, workers, func(v interface{}) []interface{} {
+		return []interface{}{fn(v)}
+	})
+}
+
+// FlatMap pipe all results of fn(v) of values from readC into writeC by workers goroutines,
+// values are out of order if workers > 1
+func FlatMap(readC interface{}, writeC interface{}, workers int, fn func(interface{}) []interface{}) (*Joint, error) {
+	if readC == nil || writeC == nil {
+		return nil, errors.New("data channel should not be nil")
+	}
+	rtp, wtp := reflect.TypeOf(readC), reflect.TypeOf(writeC)
+	if rtp.Kind() != reflect.Chan || wtp.Kind() != reflect.Chan {
+		return nil, errors.New("argument should be channel")
+	}
+	if rtp.ChanDir() == reflect.SendDir {
+		return nil, errors.New("read channel should be readable")
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	elem := wtp.Elem()
+	return stage([]reflect.Value{reflect.ValueOf(readC)}, writeC, workers, func(v reflect.Value) []reflect.Value {
+		var list []reflect.Value
+		for _, out := range fn(v.Interface()) {
+			if out == nil {
+				list = append(list, reflect.Zero(elem))
+			} else if ov := reflect.ValueOf(out); ov.Type().AssignableTo(elem) {
+				list = append(list, ov)
+			} else {
+				log.Printf("[joint] drop %v, type should be %v", out, elem)
+			}
+		}
+		return list
+	})
+}
+
+// stage read values from every read channel by workers goroutines, send fn results into a pipe to writeC;
+// pipe input is closed when all read channels are closed
+func stage(readCs []reflect.Value, writeC interface{}, workers int, fn func(reflect.Value) []reflect.Value) (*Joint, error) {
+	wtp := reflect.TypeOf(writeC)
+	if wtp.Kind() != reflect.Chan {
+		return nil, errors.New("argument should be channel")
+	}
+	inC := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, wtp.Elem()), 0)
+	j, err := Pipe(inC.Interface(), writeC)
+	if err != nil {
+		return nil, err
+	}
+	doneC := reflect.ValueOf(j.DoneC())
+	wg := new(sync.WaitGroup)
+	for _, readC := range readCs {
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(readC reflect.Value) {
+				defer wg.Done()
+				recv := []reflect.SelectCase{
+					{Dir: reflect.SelectRecv, Chan: readC},
+					{Dir: reflect.SelectRecv, Chan: doneC},
+				}
+				send := []reflect.SelectCase{
+					{Dir: reflect.SelectSend, Chan: inC},
+					{Dir: reflect.SelectRecv, Chan: doneC},
+				}
+				for {
+					chosen, v, ok := reflect.Select(recv)
+					if chosen == 1 || !ok {
+						return
+					}
+					for _, out := range fn(v) {
+						send[0].Send = out
+						if chosen, _, _ := reflect.Select(send); chosen == 1 {
+							return
+						}
+					}
+				}
+			}(readC)
+		}
+	}
+	go func() {
+		wg.Wait()
+		inC.Close()
+	}()
+	return j, nil
+}
+
+// Split pipe values of readC to write channels by round-robin
+func Split(readC interface{}, writeCs ...interface{}) (*Joint, error) {
+	var i int
+	return split(readC, writeCs, func(interface{}) int {
+		n := i
+		i = (i + 1) % len(writeCs)
+		return n
+	})
+}
+
+// SplitByKey pipe values of readC to write channels by hash of key(v), values of the same key go to the same channel
+func SplitByKey(readC interface{}, key func(interface{}) string, writeCs ...interface{}) (*Joint, error) {
+	return split(readC, writeCs, func(v interface{}) int {
+		h := fnv.New32a()
+		h.Write([]byte(key(v)))
+		return int(h.Sum32() % uint32(len(writeCs)))
+	})
+}
+
+func split(readC interface{}, writeCs []interface{}, pick func(interface{}) int) (*Joint, error) {
+	if len(writeCs) == 0 {
+		return nil, errors.New("no write channel")
+	}
+	var wvs []reflect.Value
+	for _, writeC := range writeCs {
+		if readC == nil || writeC == nil {
+			return nil, errors.New("data channel should not be nil")
+		}
+		_, wv, err := checkChan(readC, writeC)
+		if err != nil {
+			return nil, err
+		}
+		wvs = append(wvs, wv)
+	}
+	outC := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, reflect.TypeOf(readC).Elem()), 0)
+	j, err := Pipe(readC, outC.Interface())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		doneC := reflect.ValueOf(j.DoneC())
+		recv := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: outC},
+			{Dir: reflect.SelectRecv, Chan: doneC},
+		}
+		send := []reflect.SelectCase{
+			{Dir: reflect.SelectSend},
+			{Dir: reflect.SelectRecv, Chan: doneC},
+		}
+		for {
+			chosen, v, _ := reflect.Select(recv)
+			if chosen == 1 {
+				return
+			}
+			wv := wvs[pick(v.Interface())]
+			send[0].Chan, send[0].Send = wv, v
+			if chosen, _, _ = reflect.Select(send); chosen == 1 {
+				// pipe ends because readC is closed, deliver the last value
+				if atomic.LoadInt32(&j.drained) == 1 {
+					wv.Send(v)
+				}
+				return
+			}
+		}
+	}()
+	return j, nil
+}
@@ -21,6 +21,11 @@ type MessageHandle interface {
 	Error(err error)
 }
 
+// Consumer poll messages and dispatch them to handler, both SimpleConsumer and MemoryConsumer implement it
+type Consumer interface {
+	PollMessage(handler MessageHandle) error
+}
+
 func NewConsumer(brokers []string, service string, topics ...string) *SimpleConsumer {
 	return &SimpleConsumer{
 		brokers: brokers,
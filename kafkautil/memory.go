@@ -0,0 +1,323 @@
+package kafkautil
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Message stored in MemoryBroker
+type Message struct {
+	Topic     string
+	Key       string
+	Value     []byte
+	Partition int32
+	Offset    int64
+}
+
+// MemoryBroker in-process kafka broker, used to test MessageHandle without a live broker
+// messages are partitioned by key like sarama's hash partitioner,
+// offsets are committed per consumer group and a message is redelivered until handler returns nil
+type MemoryBroker struct {
+	partitions    int32
+	initialOffset int64
+	topics        map[string][][]*Message
+	offsets       map[string]map[string][]int64 // group => topic => partition offsets
+	claimed       map[string]map[string][]bool  // group => topic => partition in flight
+	closed        bool
+	cond          *sync.Cond
+	*sync.Mutex
+}
+
+// NewMemoryBroker create broker, every topic has partitions partitions
+func NewMemoryBroker(partitions int) *MemoryBroker {
+	if partitions <= 0 {
+		partitions = 1
+	}
+	mu := new(sync.Mutex)
+	return &MemoryBroker{
+		partitions:    int32(partitions),
+		initialOffset: sarama.OffsetNewest,
+		topics:        make(map[string][][]*Message),
+		offsets:       make(map[string]map[string][]int64),
+		claimed:       make(map[string]map[string][]bool),
+		cond:          sync.NewCond(mu),
+		Mutex:         mu,
+	}
+}
+
+// SetInitialOffset sarama.OffsetNewest(default, same as SimpleConsumer) or sarama.OffsetOldest, affect groups registered afterwards
+func (b *MemoryBroker) SetInitialOffset(offset int64) *MemoryBroker {
+	if offset == sarama.OffsetNewest || offset == sarama.OffsetOldest {
+		b.Lock()
+		b.initialOffset = offset
+		b.Unlock()
+	}
+	return b
+}
+
+// NewProducer create producer sending to this broker
+func (b *MemoryBroker) NewProducer() *MemoryProducer {
+	return &MemoryProducer{broker: b}
+}
+
+// NewConsumer create consumer of group service, the group offsets are initialized on first registration
+func (b *MemoryBroker) NewConsumer(service string, topics ...string) *MemoryConsumer {
+	b.Lock()
+	for _, topic := range topics {
+		b.registerGroup(service, topic)
+	}
+	b.Unlock()
+	return &MemoryConsumer{
+		broker:        b,
+		service:       service,
+		topics:        topics,
+		retryInterval: 1 * time.Second,
+		canexit:       make(chan struct{}),
+		errC:          make(chan error, 16),
+	}
+}
+
+// Messages list all messages of topic partition
+func (b *MemoryBroker) Messages(topic string, partition int32) []Message {
+	b.Lock()
+	defer b.Unlock()
+	parts, ok := b.topics[topic]
+	if !ok || partition < 0 || partition >= b.partitions {
+		return nil
+	}
+	list := make([]Message, len(parts[partition]))
+	for i, msg := range parts[partition] {
+		list[i] = *msg
+	}
+	return list
+}
+
+// Offset committed offset of group, it's the offset of next message to consume
+func (b *MemoryBroker) Offset(service, topic string, partition int32) int64 {
+	b.Lock()
+	defer b.Unlock()
+	if partition < 0 || partition >= b.partitions {
+		return 0
+	}
+	if offsets, ok := b.offsets[service][topic]; ok {
+		return offsets[partition]
+	}
+	return 0
+}
+
+// Lag count of messages not committed by group
+func (b *MemoryBroker) Lag(service, topic string) int64 {
+	b.Lock()
+	defer b.Unlock()
+	offsets, ok := b.offsets[service][topic]
+	if !ok {
+		return 0
+	}
+	var lag int64
+	for p, log := range b.topics[topic] {
+		lag += int64(len(log)) - offsets[p]
+	}
+	return lag
+}
+
+// Partition return partition of key
+func (b *MemoryBroker) Partition(key string) int32 {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key))
+	partition := int32(hasher.Sum32()) % b.partitions
+	if partition < 0 {
+		partition = -partition
+	}
+	return partition
+}
+
+// Close broker, all consumers would exit PollMessage
+func (b *MemoryBroker) Close() {
+	b.Lock()
+	b.closed = true
+	b.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *MemoryBroker) produce(topic, key string, data []byte) error {
+	if topic == "" {
+		return errors.New("empty topic")
+	}
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return errors.New("broker closed")
+	}
+	parts := b.topicPartitions(topic)
+	p := b.Partition(key)
+	value := make([]byte, len(data))
+	copy(value, data)
+	parts[p] = append(parts[p], &Message{
+		Topic:     topic,
+		Key:       key,
+		Value:     value,
+		Partition: p,
+		Offset:    int64(len(parts[p])),
+	})
+	b.Unlock()
+	b.cond.Broadcast()
+	return nil
+}
+
+func (b *MemoryBroker) topicPartitions(topic string) [][]*Message {
+	parts, ok := b.topics[topic]
+	if !ok {
+		parts = make([][]*Message, b.partitions)
+		b.topics[topic] = parts
+	}
+	return parts
+}
+
+func (b *MemoryBroker) registerGroup(service, topic string) {
+	if _, ok := b.offsets[service]; !ok {
+		b.offsets[service] = make(map[string][]int64)
+		b.claimed[service] = make(map[string][]bool)
+	}
+	if _, ok := b.offsets[service][topic]; ok {
+		return
+	}
+	parts := b.topicPartitions(topic)
+	offsets := make([]int64, b.partitions)
+	if b.initialOffset == sarama.OffsetNewest {
+		for p := range parts {
+			offsets[p] = int64(len(parts[p]))
+		}
+	}
+	b.offsets[service][topic] = offsets
+	b.claimed[service][topic] = make([]bool, b.partitions)
+}
+
+// claim block until a message is available for consumer, a claimed partition is invisible to other members of the group until commit or release
+func (b *MemoryBroker) claim(mc *MemoryConsumer) (*Message, bool) {
+	b.Lock()
+	defer b.Unlock()
+	for {
+		if b.closed || mc.closed {
+			return nil, false
+		}
+		for i := range mc.topics {
+			topic := mc.topics[(mc.cursor+i)%len(mc.topics)]
+			offsets, claimed, parts := b.offsets[mc.service][topic], b.claimed[mc.service][topic], b.topics[topic]
+			for p := range parts {
+				if !claimed[p] && offsets[p] < int64(len(parts[p])) {
+					claimed[p] = true
+					mc.cursor++
+					return parts[p][offsets[p]], true
+				}
+			}
+		}
+		b.cond.Wait()
+	}
+}
+
+func (b *MemoryBroker) commit(service string, msg *Message) {
+	b.Lock()
+	b.offsets[service][msg.Topic][msg.Partition] = msg.Offset + 1
+	b.claimed[service][msg.Topic][msg.Partition] = false
+	b.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *MemoryBroker) release(service string, msg *Message) {
+	b.Lock()
+	b.claimed[service][msg.Topic][msg.Partition] = false
+	b.Unlock()
+	b.cond.Broadcast()
+}
+
+// MemoryProducer producer of MemoryBroker
+type MemoryProducer struct {
+	broker *MemoryBroker
+}
+
+// Send message to memory broker
+func (mp *MemoryProducer) Send(topic, partitionKey string, data []byte) error {
+	return mp.broker.produce(topic, partitionKey, data)
+}
+
+// MemoryConsumer consumer of MemoryBroker
+type MemoryConsumer struct {
+	broker        *MemoryBroker
+	service       string
+	topics        []string
+	retryInterval time.Duration
+	cursor        int
+	closed        bool
+	canexit       chan struct{}
+	errC          chan error
+	once          sync.Once
+}
+
+// SetRetryInterval interval before redelivering a message whose handler failed, default 1s
+func (mc *MemoryConsumer) SetRetryInterval(d time.Duration) *MemoryConsumer {
+	if d > 0 {
+		mc.retryInterval = d
+	}
+	return mc
+}
+
+// Errors errors returned by handler before redelivery, dropped if not drained in time, closed by Close
+func (mc *MemoryConsumer) Errors() <-chan error {
+	return mc.errC
+}
+
+// PollMessage consume messages until Close, same as SimpleConsumer the offset is committed only when handler returns nil
+func (mc *MemoryConsumer) PollMessage(handler MessageHandle) error {
+	if len(mc.topics) == 0 {
+		return errors.New("no topics")
+	}
+	for {
+		msg, ok := mc.broker.claim(mc)
+		if !ok {
+			return nil
+		}
+		for {
+			// handler gets a copy, so the stored message can't be modified
+			herr := handler.Message(msg.Topic, msg.Key, append([]byte(nil), msg.Value...))
+			if herr == nil {
+				mc.broker.commit(mc.service, msg)
+				break
+			}
+			mc.reportError(herr)
+			select {
+			case <-mc.canexit:
+				mc.broker.release(mc.service, msg)
+				return nil
+			case <-time.After(mc.retryInterval):
+			}
+		}
+	}
+}
+
+// Close stop PollMessage, uncommitted message would be redelivered to other consumers of the group
+func (mc *MemoryConsumer) Close() {
+	mc.once.Do(func() {
+		mc.broker.Lock()
+		mc.closed = true
+		close(mc.errC)
+		mc.broker.Unlock()
+		close(mc.canexit)
+		mc.broker.cond.Broadcast()
+	})
+}
+
+func (mc *MemoryConsumer) reportError(err error) {
+	mc.broker.Lock()
+	defer mc.broker.Unlock()
+	if mc.closed {
+		return
+	}
+	select {
+	case mc.errC <- err:
+	default:
+	}
+}
@@ -0,0 +1,160 @@
+package kafkautil
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+type recordHandler struct {
+	sync.Mutex
+	failures int
+	received []string
+	doneC    chan struct{}
+	expect   int
+}
+
+func (h *recordHandler) Message(topic string, partitionKey string, data []byte) error {
+	h.Lock()
+	defer h.Unlock()
+	if h.failures > 0 {
+		h.failures--
+		return errors.New("handle fail")
+	}
+	h.received = append(h.received, string(data))
+	if len(h.received) == h.expect {
+		close(h.doneC)
+	}
+	return nil
+}
+
+func (h *recordHandler) Error(err error) {}
+
+func TestMemoryPartitionByKey(t *testing.T) {
+	b := NewMemoryBroker(4)
+	var p Producer = b.NewProducer()
+	for i := 0; i < 10; i++ {
+		if err := p.Send("topic", "same-key", []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs := b.Messages("topic", b.Partition("same-key"))
+	if len(msgs) != 10 {
+		t.Fatalf("all messages should be in one partition, got %d", len(msgs))
+	}
+	for i, msg := range msgs {
+		if msg.Offset != int64(i) || msg.Value[0] != byte(i) {
+			t.Fatal("bad sequence")
+		}
+	}
+}
+
+func TestMemoryRedeliverOnError(t *testing.T) {
+	b := NewMemoryBroker(2)
+	c := b.NewConsumer("group", "topic").SetRetryInterval(time.Millisecond)
+	p := b.NewProducer()
+	p.Send("topic", "k1", []byte("a"))
+	p.Send("topic", "k1", []byte("b"))
+	h := &recordHandler{failures: 3, expect: 2, doneC: make(chan struct{})}
+	go c.PollMessage(h)
+	select {
+	case <-h.doneC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("should consume all messages")
+	}
+	c.Close()
+	if h.received[0] != "a" || h.received[1] != "b" {
+		t.Fatalf("bad sequence %v", h.received)
+	}
+	var errs int
+	for range c.Errors() {
+		errs++
+	}
+	if errs != 3 {
+		t.Fatalf("should report 3 handler errors, got %d", errs)
+	}
+	if lag := b.Lag("group", "topic"); lag != 0 {
+		t.Fatalf("lag should be 0, got %d", lag)
+	}
+	if off := b.Offset("group", "topic", b.Partition("k1")); off != 2 {
+		t.Fatalf("offset should be 2, got %d", off)
+	}
+}
+
+func TestMemoryGroupOffsets(t *testing.T) {
+	b := NewMemoryBroker(3)
+	p := b.NewProducer()
+	p.Send("topic", "before", []byte("skipped"))
+	newest := b.NewConsumer("g1", "topic")
+	oldest := b.SetInitialOffset(sarama.OffsetOldest).NewConsumer("g2", "topic")
+	keys := []string{"x", "y", "z", "w"}
+	for _, k := range keys {
+		p.Send("topic", k, []byte(k))
+	}
+	h1 := &recordHandler{expect: len(keys), doneC: make(chan struct{})}
+	h2 := &recordHandler{expect: len(keys) + 1, doneC: make(chan struct{})}
+	var c Consumer = newest
+	go c.PollMessage(h1)
+	go oldest.PollMessage(h2)
+	for _, h := range []*recordHandler{h1, h2} {
+		select {
+		case <-h.doneC:
+		case <-time.After(5 * time.Second):
+			t.Fatal("should consume all messages")
+		}
+	}
+	newest.Close()
+	oldest.Close()
+	if b.Lag("g1", "topic") != 0 || b.Lag("g2", "topic") != 0 {
+		t.Fatal("all messages should be committed")
+	}
+	// new member of g1 should not receive committed messages
+	again := b.NewConsumer("g1", "topic")
+	h3 := &recordHandler{expect: 1, doneC: make(chan struct{})}
+	go again.PollMessage(h3)
+	p.Send("topic", "after", []byte("after"))
+	select {
+	case <-h3.doneC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("should consume new message")
+	}
+	b.Close()
+	if len(h3.received) != 1 || h3.received[0] != "after" {
+		t.Fatalf("should only get new message, got %v", h3.received)
+	}
+}
+
+type mutateHandler struct {
+	doneC chan struct{}
+}
+
+func (h *mutateHandler) Message(topic string, partitionKey string, data []byte) error {
+	data[0] = 'x'
+	close(h.doneC)
+	return nil
+}
+
+func (h *mutateHandler) Error(err error) {}
+
+func TestMemoryHandlerCopy(t *testing.T) {
+	b := NewMemoryBroker(1)
+	c := b.NewConsumer("group", "topic")
+	b.NewProducer().Send("topic", "k", []byte("a"))
+	h := &mutateHandler{doneC: make(chan struct{})}
+	go c.PollMessage(h)
+	select {
+	case <-h.doneC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("should consume message")
+	}
+	c.Close()
+	if msgs := b.Messages("topic", 0); string(msgs[0].Value) != "a" {
+		t.Fatalf("stored message should not be modified by handler, got %s", msgs[0].Value)
+	}
+	if _, ok := <-c.Errors(); ok {
+		t.Fatal("Errors should be closed by Close")
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"github.com/Shopify/sarama"
 )
 
+// Producer send message to topic, both SimpleProducer and MemoryProducer implement it
+type Producer interface {
+	Send(topic, partitionKey string, data []byte) error
+}
+
 type SimpleProducer struct {
 	sarama.SyncProducer
 }
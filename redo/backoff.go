@@ -0,0 +1,62 @@
+package redo
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff retry interval after failures
+type Backoff interface {
+	// Next delay after failures(>=1) consecutive failures
+	Next(failures int) time.Duration
+}
+
+// ConstantBackoff same delay after every failure
+type ConstantBackoff time.Duration
+
+// Next constant delay
+func (b ConstantBackoff) Next(failures int) time.Duration {
+	return time.Duration(b)
+}
+
+// ExponentialBackoff delay is Initial*Multiplier^(failures-1) capped by Max,
+// then randomized in [delay*(1-Jitter), delay]
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64 // default 2
+	Jitter     float64 // [0,1]
+}
+
+// NewExponentialBackoff create backoff doubling from initial up to max
+func NewExponentialBackoff(initial, max time.Duration) *ExponentialBackoff {
+	return &ExponentialBackoff{Initial: initial, Max: max, Multiplier: 2}
+}
+
+// WithJitter set jitter factor
+func (b *ExponentialBackoff) WithJitter(jitter float64) *ExponentialBackoff {
+	if jitter >= 0 && jitter <= 1 {
+		b.Jitter = jitter
+	}
+	return b
+}
+
+// Next exponential delay
+func (b *ExponentialBackoff) Next(failures int) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(failures-1))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay -= delay * b.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,240 @@
+package redo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decide when next loop starts
+type Schedule interface {
+	// Next return start time of next loop, start/end is the time last loop started/ended
+	Next(start, end time.Time) time.Time
+}
+
+// cronSchedule bit set of every field, bit n set means value n matches
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	location                              *time.Location
+}
+
+type cronField struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	secondField = cronField{min: 0, max: 59}
+	minuteField = cronField{min: 0, max: 59}
+	hourField   = cronField{min: 0, max: 23}
+	domField    = cronField{min: 1, max: 31}
+	monthField  = cronField{min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is sunday too
+	dowField = cronField{min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// starBit set if field is * or ?, used by day matching
+const starBit = 1 << 63
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// ParseCron parse standard cron spec in local time zone:
+// 5 fields "min hour dom month dow" or 6 fields "sec min hour dom month dow",
+// field supports * ? , - / and month/weekday names, descriptors like @daily are supported too;
+// prefix "CRON_TZ=Asia/Shanghai " or "TZ=Asia/Shanghai " to set time zone
+func ParseCron(spec string) (Schedule, error) {
+	return parseCron(spec, time.Local)
+}
+
+func parseCron(spec string, loc *time.Location) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.Index(spec, " ")
+		if i < 0 {
+			return nil, fmt.Errorf("bad cron spec %q", spec)
+		}
+		name := spec[strings.Index(spec, "=")+1 : i]
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("bad cron time zone %q: %v", name, err)
+		}
+		loc, spec = l, strings.TrimSpace(spec[i:])
+	}
+	if strings.HasPrefix(spec, "@") {
+		d, ok := cronDescriptors[spec]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron descriptor %q", spec)
+		}
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron spec %q should have 5 or 6 fields", spec)
+	}
+	s := &cronSchedule{location: loc}
+	var err error
+	for i, f := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.second, secondField},
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		if *f.bits, err = parseCronField(fields[i], f.field); err != nil {
+			return nil, fmt.Errorf("bad cron spec %q: %v", spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := parseCronRange(part, field)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+func parseCronRange(expr string, field cronField) (uint64, error) {
+	var start, end, step uint = 0, 0, 1
+	var extra uint64
+	rangeAndStep := strings.Split(expr, "/")
+	if len(rangeAndStep) > 2 {
+		return 0, fmt.Errorf("bad range %q", expr)
+	}
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("bad range %q", expr)
+		}
+		start, end = field.min, field.max
+		extra = starBit
+	} else {
+		var err error
+		if start, err = parseCronValue(lowAndHigh[0], field); err != nil {
+			return 0, err
+		}
+		switch len(lowAndHigh) {
+		case 1:
+			end = start
+		case 2:
+			if end, err = parseCronValue(lowAndHigh[1], field); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("bad range %q", expr)
+		}
+	}
+	if len(rangeAndStep) == 2 {
+		n, err := strconv.ParseUint(rangeAndStep[1], 10, 8)
+		if err != nil || n == 0 {
+			return 0, fmt.Errorf("bad step %q", expr)
+		}
+		step = uint(n)
+		// n/step means n-max/step
+		if len(lowAndHigh) == 1 && extra == 0 {
+			end = field.max
+		}
+		extra = 0
+	}
+	if start < field.min || end > field.max || start > end {
+		return 0, fmt.Errorf("range %q out of [%d,%d]", expr, field.min, field.max)
+	}
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits | extra, nil
+}
+
+func parseCronValue(s string, field cronField) (uint, error) {
+	if v, ok := field.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	return uint(n), nil
+}
+
+// Next first matched time after end
+func (s *cronSchedule) Next(start, end time.Time) time.Time {
+	t := end.In(s.location).Add(time.Second - time.Duration(end.Nanosecond()))
+	// give up if no match in 5 years, e.g. Feb 30
+	yearLimit := t.Year() + 5
+WRAP:
+	for t.Year() <= yearLimit {
+		for s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			if t.Month() == time.January {
+				continue WRAP
+			}
+		}
+		for !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			if t.Day() == 1 {
+				continue WRAP
+			}
+		}
+		for s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			if t.Hour() == 0 {
+				continue WRAP
+			}
+		}
+		for s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			if t.Minute() == 0 {
+				continue WRAP
+			}
+		}
+		for s.second&(1<<uint(t.Second())) == 0 {
+			t = t.Truncate(time.Second).Add(time.Second)
+			if t.Second() == 0 {
+				continue WRAP
+			}
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches if both day of month and day of week are restricted, either matches
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.dom&starBit != 0 || s.dow&starBit != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,78 @@
+package redo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	base := time.Date(2020, 2, 28, 23, 58, 30, 500, loc)
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/5 * * * *", time.Date(2020, 2, 29, 0, 0, 0, 0, loc)},
+		{"*/20 * * * * *", time.Date(2020, 2, 28, 23, 58, 40, 0, loc)},
+		{"0 12 * * mon-fri", time.Date(2020, 3, 2, 12, 0, 0, 0, loc)},
+		{"30 8 1,15 * ?", time.Date(2020, 3, 1, 8, 30, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, loc)},
+		{"0 0 1 jan,jul *", time.Date(2020, 7, 1, 0, 0, 0, 0, loc)},
+		{"0 0 * * 7", time.Date(2020, 3, 1, 0, 0, 0, 0, loc)},
+		{"0 9 13 * 5", time.Date(2020, 3, 6, 9, 0, 0, 0, loc)},
+		{"@hourly", time.Date(2020, 2, 29, 0, 0, 0, 0, loc)},
+		{"CRON_TZ=UTC 0 16 * * *", time.Date(2020, 2, 28, 16, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		s, err := parseCron(c.spec, loc)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec, err)
+		}
+		if next := s.Next(base, base); !next.Equal(c.next) {
+			t.Fatalf("%s: expect %v, got %v", c.spec, c.next, next)
+		}
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@never", "TZ=Bad/Zone * * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Fatalf("%q should be invalid", spec)
+		}
+	}
+	s, _ := ParseCron("0 0 30 2 *")
+	if next := s.Next(base, base); !next.IsZero() {
+		t.Fatal("Feb 30 should never match")
+	}
+}
+
+func TestFixedRate(t *testing.T) {
+	start := time.Now()
+	delay := intervalSchedule{interval: time.Second}
+	rate := intervalSchedule{interval: time.Second, fixedRate: true}
+	end := start.Add(300 * time.Millisecond)
+	if next := delay.Next(start, end); !next.Equal(end.Add(time.Second)) {
+		t.Fatal("fixed delay counts from end")
+	}
+	if next := rate.Next(start, end); !next.Equal(start.Add(time.Second)) {
+		t.Fatal("fixed rate counts from start")
+	}
+	if next := rate.Next(start, start.Add(2500*time.Millisecond)); !next.Equal(start.Add(3 * time.Second)) {
+		t.Fatal("fixed rate should skip missed loops")
+	}
+}
+
+func TestPerformCron(t *testing.T) {
+	ch := make(chan time.Time, 10)
+	rep, err := PerformCron(WrapFunc(func() { ch <- time.Now() }), "* * * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := <-ch
+	second := <-ch
+	rep.Stop()
+	rep.Wait()
+	if first.Nanosecond() > int(100*time.Millisecond) || second.Sub(first) < 900*time.Millisecond {
+		t.Fatalf("should run on whole seconds, got %v %v", first, second)
+	}
+}
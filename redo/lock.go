@@ -0,0 +1,100 @@
+package redo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/qjpcpu/common/redisutil"
+)
+
+// Locker guard loops of job shared by replicas
+type Locker interface {
+	// Lock try to lock the loop before it starts, tick is the scheduled time of loop bucketed by schedule,
+	// it's zero for loop triggered by Wakeup or SetDelayBeforeNext;
+	// return false to skip the loop, release is called with result of the loop
+	Lock(ctx context.Context, tick time.Time) (release func(err error), ok bool, err error)
+}
+
+// redis-cli --eval lock.lua running_key [tick_key] , token ttl_ms
+var lockScript = redisutil.NewScript(-1, `
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+  if #KEYS < 2 or redis.call("SET", KEYS[2], ARGV[1], "NX", "PX", ARGV[2]) then
+    return 1
+  end
+  redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// redis-cli --eval unlock.lua running_key [tick_key] , token
+var unlockScript = redisutil.NewScript(-1, `
+for _, key in ipairs(KEYS) do
+  if redis.call("GET", key) == ARGV[1] then
+    redis.call("DEL", key)
+  end
+end
+return 1
+`)
+
+type redisLocker struct {
+	pool *redisutil.Pool
+	key  string
+	ttl  time.Duration
+}
+
+// NewRedisLocker locker backed by redis, a loop runs only if no loop of the job is running on any replica,
+// and a scheduled tick runs only once among replicas unless it fails;
+// ttl should be longer than job execution time plus clock skew between replicas,
+// use hash tag like {job} in key for redis cluster
+func NewRedisLocker(pool *redisutil.Pool, key string, ttl time.Duration) Locker {
+	return &redisLocker{pool: pool, key: key, ttl: ttl}
+}
+
+func (l *redisLocker) Lock(ctx context.Context, tick time.Time) (func(error), bool, error) {
+	conn, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+	token := lockToken()
+	keys := []interface{}{l.key + ":running"}
+	if !tick.IsZero() {
+		keys = append(keys, l.key+":tick:"+strconv.FormatInt(tick.UnixNano()/int64(time.Millisecond), 10))
+	}
+	ok, err := redisutil.Bool(lockScript.Do(conn, scriptArgs(keys, token, int64(l.ttl/time.Millisecond))...))
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func(jobErr error) {
+		// done tick is kept until ttl expires so that replicas with skewed clock skip it, failed tick can be retried
+		if jobErr == nil {
+			keys = keys[:1]
+		}
+		conn := l.pool.Get()
+		defer conn.Close()
+		unlockScript.Do(conn, scriptArgs(keys, token)...)
+	}, true, nil
+}
+
+// scriptArgs args of script with variable key count
+func scriptArgs(keys []interface{}, args ...interface{}) []interface{} {
+	list := append([]interface{}{len(keys)}, keys...)
+	return append(list, args...)
+}
+
+func lockToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// tickOf bucket scheduled time so that replicas share tick
+func tickOf(sched Schedule, t time.Time) time.Time {
+	if s, ok := sched.(intervalSchedule); ok && s.interval > 0 {
+		return t.Truncate(s.interval)
+	}
+	return t.Truncate(time.Second)
+}
@@ -0,0 +1,73 @@
+package redo
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/qjpcpu/common/redisutil"
+)
+
+func TestRedisLocker(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pool := redisutil.CreatePool(s.Addr(), "", "")
+	var runs int32
+	job := WrapFunc(func() { atomic.AddInt32(&runs, 1) })
+	rep1 := Perform(job, 200*time.Millisecond, WithLocker(NewRedisLocker(pool, "report", time.Second)))
+	rep2 := Perform(job, 200*time.Millisecond, WithLocker(NewRedisLocker(pool, "report", time.Second)))
+	time.Sleep(time.Second)
+	rep1.Concat(rep2).Stop()
+	rep1.Wait()
+	rep2.Wait()
+	// one run per 200ms tick among replicas
+	if n := atomic.LoadInt32(&runs); n < 4 || n > 7 {
+		t.Fatalf("bad runs %d", n)
+	}
+	if rep1.Stats().Skips+rep2.Stats().Skips < 4 {
+		t.Fatalf("replicas should skip ticks %+v %+v", rep1.Stats(), rep2.Stats())
+	}
+}
+
+func TestSkipIfRunning(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pool := redisutil.CreatePool(s.Addr(), "", "")
+	started, finish := make(chan struct{}), make(chan struct{})
+	rep1 := Perform(WrapFunc(func() {
+		close(started)
+		<-finish
+	}), time.Hour, WithLocker(NewRedisLocker(pool, "report", time.Minute)), WithSkipIfRunning())
+	<-started
+	waitFor(t, func() bool { return rep1.Stats().Status == StatusRunning })
+	if rep1.Wakeup() {
+		t.Fatal("wakeup should be dropped while running")
+	}
+	// loop of another replica is skipped while rep1 is running
+	var runs int32
+	rep2 := Perform(WrapFunc(func() { atomic.AddInt32(&runs, 1) }), time.Hour, WithLocker(NewRedisLocker(pool, "report", time.Minute)))
+	waitFor(t, func() bool { return rep2.Stats().Skips == 1 })
+	close(finish)
+	waitFor(t, func() bool { return rep1.Stats().Status == StatusSleeping })
+	rep2.Wakeup()
+	waitFor(t, func() bool { return atomic.LoadInt32(&runs) == 1 })
+	rep1.Stop()
+	rep2.Stop()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 500; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
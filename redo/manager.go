@@ -0,0 +1,231 @@
+package redo
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qjpcpu/common/json"
+)
+
+// JobStatus runtime status of job
+type JobStatus string
+
+const (
+	// StatusRunning job is executing a loop
+	StatusRunning JobStatus = "running"
+	// StatusSleeping job is waiting for next loop
+	StatusSleeping = "sleeping"
+	// StatusPaused job is paused, scheduled loops are skipped
+	StatusPaused = "paused"
+	// StatusStopped job is done
+	StatusStopped = "stopped"
+)
+
+// JobStats runtime statistics of job
+type JobStats struct {
+	Name                string        `json:"name"`
+	Status              JobStatus     `json:"status"`
+	LastRun             time.Time     `json:"last_run"`
+	NextRun             time.Time     `json:"next_run"`
+	LastDuration        time.Duration `json:"last_duration"`
+	LastError           string        `json:"last_error,omitempty"`
+	Runs                uint64        `json:"runs"`
+	Failures            uint64        `json:"failures"`
+	Skips               uint64        `json:"skips"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	StopType            StopType      `json:"stop_type,omitempty"`
+}
+
+var (
+	// ErrJobExists job name is taken
+	ErrJobExists = errors.New("job already exists")
+	// ErrJobNotFound no job of the name
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobConflict action does nothing in current state of job, e.g. pause a paused job or trigger a stopped job
+	ErrJobConflict = errors.New("action conflicts with job state")
+)
+
+// Manager registry of named jobs, it's also a http.Handler for ops:
+// GET lists jobs, GET ?name=x shows a job, POST ?name=x&action=pause|resume|trigger|stop controls a job,
+// it answers 409 if the action does nothing in current state of job
+type Manager struct {
+	jobs map[string]*Recipet
+	*sync.RWMutex
+}
+
+// NewManager new job manager
+func NewManager() *Manager {
+	return &Manager{
+		jobs:    make(map[string]*Recipet),
+		RWMutex: new(sync.RWMutex),
+	}
+}
+
+// Add register job by name, stopped jobs stay listed until Remove
+func (mgr *Manager) Add(name string, r *Recipet) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+	if _, ok := mgr.jobs[name]; ok {
+		return ErrJobExists
+	}
+	mgr.jobs[name] = r
+	return nil
+}
+
+// Perform perform job and register it by name, job is not started if name is taken
+func (mgr *Manager) Perform(name string, once Job, duration time.Duration, opts ...Option) (*Recipet, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+	if _, ok := mgr.jobs[name]; ok {
+		return nil, ErrJobExists
+	}
+	r := Perform(once, duration, opts...)
+	mgr.jobs[name] = r
+	return r, nil
+}
+
+// Remove unregister job, the job is not stopped
+func (mgr *Manager) Remove(name string) *Recipet {
+	mgr.Lock()
+	defer mgr.Unlock()
+	r := mgr.jobs[name]
+	delete(mgr.jobs, name)
+	return r
+}
+
+// Get job by name
+func (mgr *Manager) Get(name string) (*Recipet, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	r, ok := mgr.jobs[name]
+	return r, ok
+}
+
+// Stats statistics of job
+func (mgr *Manager) Stats(name string) (JobStats, error) {
+	r, ok := mgr.Get(name)
+	if !ok {
+		return JobStats{}, ErrJobNotFound
+	}
+	stats := r.Stats()
+	stats.Name = name
+	return stats, nil
+}
+
+// List statistics of all jobs sorted by name
+func (mgr *Manager) List() []JobStats {
+	mgr.RLock()
+	list := make([]JobStats, 0, len(mgr.jobs))
+	for name, r := range mgr.jobs {
+		stats := r.Stats()
+		stats.Name = name
+		list = append(list, stats)
+	}
+	mgr.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Pause pause job
+func (mgr *Manager) Pause(name string) error {
+	return mgr.do(name, (*Recipet).Pause)
+}
+
+// Resume resume paused job
+func (mgr *Manager) Resume(name string) error {
+	return mgr.do(name, (*Recipet).Resume)
+}
+
+// Trigger start a loop right now
+func (mgr *Manager) Trigger(name string) error {
+	return mgr.do(name, (*Recipet).Wakeup)
+}
+
+// Stop stop job
+func (mgr *Manager) Stop(name string) error {
+	return mgr.do(name, (*Recipet).Stop)
+}
+
+// StopAll stop all jobs and wait them done
+func (mgr *Manager) StopAll() {
+	mgr.RLock()
+	list := make([]*Recipet, 0, len(mgr.jobs))
+	for _, r := range mgr.jobs {
+		list = append(list, r)
+	}
+	mgr.RUnlock()
+	for _, r := range list {
+		r.Stop()
+	}
+	for _, r := range list {
+		r.Wait()
+	}
+}
+
+func (mgr *Manager) do(name string, fn func(*Recipet) bool) error {
+	r, ok := mgr.Get(name)
+	if !ok {
+		return ErrJobNotFound
+	}
+	if !fn(r) {
+		return ErrJobConflict
+	}
+	return nil
+}
+
+// ServeHTTP show and control jobs
+func (mgr *Manager) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	switch req.Method {
+	case http.MethodGet:
+		if name == "" {
+			writeJSON(w, http.StatusOK, mgr.List())
+			return
+		}
+	case http.MethodPost:
+		var err error
+		switch action := req.URL.Query().Get("action"); action {
+		case "pause":
+			err = mgr.Pause(name)
+		case "resume":
+			err = mgr.Resume(name)
+		case "trigger":
+			err = mgr.Trigger(name)
+		case "stop":
+			err = mgr.Stop(name)
+		default:
+			writeJSON(w, http.StatusBadRequest, httpError{Error: "unknown action " + action})
+			return
+		}
+		if err == ErrJobConflict {
+			writeJSON(w, http.StatusConflict, httpError{Error: err.Error()})
+			return
+		} else if err != nil {
+			writeJSON(w, http.StatusNotFound, httpError{Error: err.Error()})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, httpError{Error: "method not allowed"})
+		return
+	}
+	stats, err := mgr.Stats(name)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, httpError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+type httpError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(json.MustMarshal(v))
+}
@@ -0,0 +1,122 @@
+package redo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	mgr := NewManager()
+	runs := make(chan uint64, 10)
+	if _, err := mgr.Perform("report", func(ctx *RedoCtx) {
+		runs <- ctx.Iteration()
+	}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Perform("report", WrapFunc(func() {}), time.Hour); err != ErrJobExists {
+		t.Fatal("name should be unique")
+	}
+	<-runs
+	srv := httptest.NewServer(mgr)
+	defer srv.Close()
+	call := func(method, query string) (int, JobStats) {
+		req, _ := http.NewRequest(method, srv.URL+"?"+query, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var stats JobStats
+		if res.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.StatusCode, stats
+	}
+	waitStatus := func(status JobStatus) JobStats {
+		for i := 0; i < 100; i++ {
+			if _, stats := call("GET", "name=report"); stats.Status == status {
+				return stats
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("job should be %s", status)
+		return JobStats{}
+	}
+	stats := waitStatus(StatusSleeping)
+	if stats.Runs != 1 || stats.NextRun.Before(time.Now().Add(time.Minute)) {
+		t.Fatalf("bad stats %+v", stats)
+	}
+	if code, stats := call("POST", "name=report&action=pause"); code != http.StatusOK || stats.Status != StatusPaused {
+		t.Fatalf("pause fail %d %+v", code, stats)
+	}
+	if code, _ := call("POST", "name=report&action=trigger"); code != http.StatusOK {
+		t.Fatal("trigger fail")
+	}
+	if it := <-runs; it != 2 {
+		t.Fatalf("trigger should run paused job, got iteration %d", it)
+	}
+	waitStatus(StatusPaused)
+	if code, _ := call("POST", "name=report&action=pause"); code != http.StatusConflict {
+		t.Fatalf("pause paused job should conflict, got %d", code)
+	}
+	if code, _ := call("POST", "name=report&action=resume"); code != http.StatusOK {
+		t.Fatal("resume fail")
+	}
+	if code, _ := call("POST", "name=report&action=resume"); code != http.StatusConflict {
+		t.Fatalf("resume running job should conflict, got %d", code)
+	}
+	if code, _ := call("POST", "name=report&action=jump"); code != http.StatusBadRequest {
+		t.Fatal("unknown action should be rejected")
+	}
+	if code, _ := call("POST", "name=nobody&action=stop"); code != http.StatusNotFound {
+		t.Fatal("unknown job should be not found")
+	}
+	call("POST", "name=report&action=stop")
+	stats = waitStatus(StatusStopped)
+	for _, action := range []string{"stop", "trigger", "pause"} {
+		if code, _ := call("POST", "name=report&action="+action); code != http.StatusConflict {
+			t.Fatalf("%s stopped job should conflict, got %d", action, code)
+		}
+	}
+	if err := mgr.Stop("report"); err != ErrJobConflict {
+		t.Fatal(err)
+	}
+	if stats.Runs != 2 || stats.StopType != STOP_USER {
+		t.Fatalf("bad stats %+v", stats)
+	}
+	if list := mgr.List(); len(list) != 1 || list[0].Name != "report" {
+		t.Fatalf("bad list %+v", list)
+	}
+	mgr.StopAll()
+}
+
+func TestPauseResume(t *testing.T) {
+	runs := make(chan uint64, 10)
+	rep := Perform(func(ctx *RedoCtx) {
+		runs <- ctx.Iteration()
+	}, 20*time.Millisecond)
+	<-runs
+	rep.Pause()
+	// drain loop which may be started before pause
+	time.Sleep(50 * time.Millisecond)
+	for len(runs) > 0 {
+		<-runs
+	}
+	time.Sleep(60 * time.Millisecond)
+	if len(runs) != 0 {
+		t.Fatal("paused job should not run")
+	}
+	rep.Resume()
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("missed loop should run on resume")
+	}
+	rep.Stop()
+	rep.Wait()
+}
@@ -0,0 +1,151 @@
+package redo
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Option perform option
+type Option func(*options)
+
+type options struct {
+	catchSignal bool
+	signals     []os.Signal
+	fixedRate   bool
+	jitter      time.Duration
+	location    *time.Location
+	backoff     Backoff
+	maxFailures int
+	panicHook   func(r interface{}, stack []byte)
+	errorHook   func(ctx *RedoCtx, err error)
+	locker      Locker
+	skipRunning bool
+	ctx         context.Context
+}
+
+func newOptions(opts []Option) *options {
+	opt := &options{location: time.Local}
+	for _, fn := range opts {
+		fn(opt)
+	}
+	return opt
+}
+
+// WithCatchSignal stop job gracefully on SIGABRT, SIGALRM, SIGHUP, SIGINT or SIGTERM, same as PerformSafe
+func WithCatchSignal() Option {
+	return func(opt *options) {
+		opt.catchSignal = true
+	}
+}
+
+// WithSignals stop job gracefully on signals instead of the default ones, it implies WithCatchSignal
+func WithSignals(signals ...os.Signal) Option {
+	return func(opt *options) {
+		opt.catchSignal = true
+		opt.signals = signals
+	}
+}
+
+// WithFixedRate interval is counted from start of last loop instead of the end, so loops don't drift by job execution time
+func WithFixedRate() Option {
+	return func(opt *options) {
+		opt.fixedRate = true
+	}
+}
+
+// WithJitter delay every loop by a random duration in [0,max)
+func WithJitter(max time.Duration) Option {
+	return func(opt *options) {
+		if max > 0 {
+			opt.jitter = max
+		}
+	}
+}
+
+// WithLocation time zone of cron spec, default is local, CRON_TZ prefix of spec takes precedence
+func WithLocation(loc *time.Location) Option {
+	return func(opt *options) {
+		if loc != nil {
+			opt.location = loc
+		}
+	}
+}
+
+// WithBackoff delay next loop by backoff after failure instead of the schedule, the schedule is restored after success
+func WithBackoff(b Backoff) Option {
+	return func(opt *options) {
+		opt.backoff = b
+	}
+}
+
+// WithMaxFailures stop job with STOP_FAILURE after n consecutive failures
+func WithMaxFailures(n int) Option {
+	return func(opt *options) {
+		if n > 0 {
+			opt.maxFailures = n
+		}
+	}
+}
+
+// WithPanicHook handle recovered panic of job instead of logging it, panic counts as failure
+func WithPanicHook(fn func(r interface{}, stack []byte)) Option {
+	return func(opt *options) {
+		opt.panicHook = fn
+	}
+}
+
+// WithErrorHook handle error returned by job wrapped by WrapErrJob
+func WithErrorHook(fn func(ctx *RedoCtx, err error)) Option {
+	return func(opt *options) {
+		opt.errorHook = fn
+	}
+}
+
+// WithLocker run loop only if locker grants it, e.g. NewRedisLocker runs a tick on only one replica
+func WithLocker(l Locker) Option {
+	return func(opt *options) {
+		opt.locker = l
+	}
+}
+
+// WithSkipIfRunning Wakeup is dropped if a loop is running, by default it's queued and starts next loop right after
+func WithSkipIfRunning() Option {
+	return func(opt *options) {
+		opt.skipRunning = true
+	}
+}
+
+// WithContext stop job with STOP_USER once ctx is done, RedoCtx.Context is derived from ctx
+func WithContext(ctx context.Context) Option {
+	return func(opt *options) {
+		opt.ctx = ctx
+	}
+}
+
+func (opt *options) jitterDelay() time.Duration {
+	if opt.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(opt.jitter)))
+}
+
+// intervalSchedule fixed delay or fixed rate schedule
+type intervalSchedule struct {
+	interval  time.Duration
+	fixedRate bool
+}
+
+// Next fixed delay counts from end, fixed rate counts from start and skips missed loops
+func (s intervalSchedule) Next(start, end time.Time) time.Time {
+	if !s.fixedRate || s.interval <= 0 {
+		return end.Add(s.interval)
+	}
+	next := start.Add(s.interval)
+	if next.Before(end) {
+		missed := end.Sub(start) / s.interval
+		next = start.Add((missed + 1) * s.interval)
+	}
+	return next
+}
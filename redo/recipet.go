@@ -1,8 +1,11 @@
 package redo
 
 import (
+	"context"
 	"os"
+	"os/signal"
 	"sync"
+	"time"
 )
 
 // StopType stop type
@@ -13,6 +16,8 @@ const (
 	STOP_SYS StopType = "SYS"
 	// STOP_USER user stop
 	STOP_USER = "USER"
+	// STOP_FAILURE stop after too many consecutive failures
+	STOP_FAILURE = "FAILURE"
 )
 
 // JobState job state
@@ -32,19 +37,31 @@ type Recipet struct {
 	wakeup      chan struct{}
 	sigchan     chan os.Signal
 	catchSignal bool
+	released    bool // signals are handled by Shutdown
 	state       JobState
 	stopType    StopType // signal or user request stop
+	ctx         context.Context
+	cancel      context.CancelFunc
+	paused      bool
+	skipRunning bool
+	resumeC     chan struct{}
+	stats       JobStats
 	*sync.Mutex
 }
 
-func newRecipet() *Recipet {
+func newRecipet(parent context.Context) *Recipet {
+	ctx, cancel := context.WithCancel(parent)
 	return &Recipet{
+		ctx:         ctx,
+		cancel:      cancel,
 		plsExit:     make(chan struct{}, 1),
 		wakeup:      make(chan struct{}, 1),
+		resumeC:     make(chan struct{}, 1),
 		done:        make(chan struct{}, 1),
 		state:       JobRunning,
 		sigchan:     make(chan os.Signal, 1),
 		catchSignal: false,
+		stats:       JobStats{Status: StatusSleeping},
 		Mutex:       new(sync.Mutex),
 	}
 }
@@ -59,6 +76,9 @@ func (m *Recipet) Wakeup() bool {
 	if m.state != JobRunning {
 		return false
 	}
+	if m.skipRunning && m.Stats().Status == StatusRunning {
+		return false
+	}
 	select {
 	case m.wakeup <- struct{}{}:
 		return true
@@ -67,25 +87,140 @@ func (m *Recipet) Wakeup() bool {
 	}
 }
 
+// Pause skip scheduled loops until Resume, running loop is not affected and Wakeup still triggers a loop
+func (m *Recipet) Pause() bool {
+	m.Lock()
+	defer m.Unlock()
+	if m.state != JobRunning || m.paused {
+		return false
+	}
+	m.paused = true
+	if m.stats.Status == StatusSleeping {
+		m.stats.Status = StatusPaused
+	}
+	return true
+}
+
+// Resume resume paused job, loop missed while paused starts right now
+func (m *Recipet) Resume() bool {
+	m.Lock()
+	defer m.Unlock()
+	if m.state != JobRunning || !m.paused {
+		return false
+	}
+	m.paused = false
+	if m.stats.Status == StatusPaused {
+		m.stats.Status = StatusSleeping
+	}
+	select {
+	case m.resumeC <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Stats runtime statistics of job
+func (m *Recipet) Stats() JobStats {
+	m.Lock()
+	defer m.Unlock()
+	return m.stats
+}
+
+func (m *Recipet) isPaused() bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.paused
+}
+
+func (m *Recipet) markSleeping(next time.Time) {
+	m.Lock()
+	m.stats.NextRun = next
+	if m.paused {
+		m.stats.Status = StatusPaused
+	} else {
+		m.stats.Status = StatusSleeping
+	}
+	m.Unlock()
+}
+
+func (m *Recipet) markRunning(start time.Time) {
+	m.Lock()
+	m.stats.Status = StatusRunning
+	m.stats.LastRun = start
+	m.stats.NextRun = time.Time{}
+	m.Unlock()
+}
+
+func (m *Recipet) markDone(err error, failures int, duration time.Duration) {
+	m.Lock()
+	m.stats.Runs++
+	m.stats.LastDuration = duration
+	m.stats.ConsecutiveFailures = failures
+	m.stats.LastError = ""
+	if err != nil {
+		m.stats.Failures++
+		m.stats.LastError = err.Error()
+	}
+	m.Unlock()
+}
+
+func (m *Recipet) markSkipped() {
+	m.Lock()
+	m.stats.Skips++
+	m.Unlock()
+}
+
 func (m *Recipet) stopWithRequest(stopType StopType) bool {
 	var op = false
-	if m.state != JobRunning {
-		return op
-	}
 	m.Lock()
 	if m.state == JobRunning {
 		m.state = JobStopping
-		if stopType == STOP_USER {
-			m.plsExit <- struct{}{}
-		}
+		m.plsExit <- struct{}{}
 		m.stopType = stopType
+		m.cancel()
 		op = true
 	}
 	m.Unlock()
 	return op
 }
 
+// catchSignals stop job with STOP_SYS once signal caught, default signals are used if none specified
+func (m *Recipet) catchSignals(signals ...os.Signal) {
+	m.Lock()
+	defer m.Unlock()
+	m.catchSignal = true
+	if m.released {
+		return
+	}
+	if len(signals) > 0 {
+		signal.Notify(m.sigchan, signals...)
+	} else {
+		batchCatchSignals(m.sigchan)
+	}
+	go func() {
+		select {
+		case <-m.sigchan:
+			m.stopWithRequest(STOP_SYS)
+		case <-m.done:
+		}
+		signal.Stop(m.sigchan)
+	}()
+}
+
+// releaseSignals stop catching signals of job, Shutdown stops it instead
+func (m *Recipet) releaseSignals() {
+	m.Lock()
+	m.released = true
+	signal.Stop(m.sigchan)
+	m.Unlock()
+}
+
 func (m *Recipet) closeChannels() {
+	m.Lock()
+	m.stats.Status = StatusStopped
+	m.stats.StopType = m.stopType
+	m.stats.NextRun = time.Time{}
+	m.Unlock()
 	close(m.plsExit)
 	close(m.done)
 	close(m.wakeup)
@@ -133,8 +268,7 @@ func NewCombiRecipt(list ...*Recipet) *CombiRecipt {
 	}
 	if len(unsafeRecipets) > 0 && len(unsafeRecipets) < len(list) {
 		for i := range unsafeRecipets {
-			unsafeRecipets[i].catchSignal = true
-			batchCatchSignals(unsafeRecipets[i].sigchan)
+			unsafeRecipets[i].catchSignals()
 		}
 	}
 	return &CombiRecipt{
@@ -144,6 +278,12 @@ func NewCombiRecipt(list ...*Recipet) *CombiRecipt {
 	}
 }
 
+func (cr *CombiRecipt) releaseSignals() {
+	for _, r := range cr.recipets {
+		r.releaseSignals()
+	}
+}
+
 // Stop stop all job
 func (cr *CombiRecipt) Stop() bool {
 	var ok bool
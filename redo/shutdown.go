@@ -0,0 +1,284 @@
+package redo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Stopper job could be stopped and waited, both Recipet and CombiRecipt are stoppers
+type Stopper interface {
+	Stop() bool
+	Wait() StopType
+}
+
+// signalReleaser job catching signals itself, e.g. PerformSafe or WithCatchSignal
+type signalReleaser interface {
+	releaseSignals()
+}
+
+type shutdownJob struct {
+	name      string
+	job       Stopper
+	dependsOn []string
+}
+
+type shutdownHook struct {
+	name    string
+	timeout time.Duration
+	fn      func(context.Context) error
+}
+
+// Shutdown coordinate graceful shutdown of the process: on stop signal jobs are stopped in dependency order,
+// then hooks run in registration order
+type Shutdown struct {
+	signals       []os.Signal
+	reloadSignals []os.Signal
+	reload        func()
+	jobTimeout    time.Duration
+	jobs          []shutdownJob
+	hooks         []shutdownHook
+	sigchan       chan os.Signal
+	once          *sync.Once
+	done          chan struct{}
+	err           error
+	*sync.Mutex
+}
+
+// NewShutdown create shutdown coordinator stopping on signals, default SIGINT and SIGTERM
+func NewShutdown(signals ...os.Signal) *Shutdown {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	return &Shutdown{
+		signals:       signals,
+		reloadSignals: []os.Signal{syscall.SIGHUP},
+		jobTimeout:    30 * time.Second,
+		sigchan:       make(chan os.Signal, 1),
+		once:          new(sync.Once),
+		done:          make(chan struct{}),
+		Mutex:         new(sync.Mutex),
+	}
+}
+
+// OnReload call fn on reload signals(default SIGHUP) instead of shutdown
+func (s *Shutdown) OnReload(fn func(), signals ...os.Signal) *Shutdown {
+	s.reload = fn
+	if len(signals) > 0 {
+		s.reloadSignals = signals
+	}
+	return s
+}
+
+// JobTimeout max time waiting jobs of same dependency level stopped, default 30s
+func (s *Shutdown) JobTimeout(d time.Duration) *Shutdown {
+	if d > 0 {
+		s.jobTimeout = d
+	}
+	return s
+}
+
+// Add register job by name, job is stopped before the jobs it depends on;
+// signals caught by job itself(PerformSafe, WithCatchSignal) are released, so only Shutdown handles signals
+func (s *Shutdown) Add(name string, job Stopper, dependsOn ...string) *Shutdown {
+	if r, ok := job.(signalReleaser); ok {
+		r.releaseSignals()
+	}
+	s.Lock()
+	s.jobs = append(s.jobs, shutdownJob{name: name, job: job, dependsOn: dependsOn})
+	s.Unlock()
+	return s
+}
+
+// Hook register shutdown hook, ctx of fn is cancelled after timeout and shutdown moves on
+func (s *Shutdown) Hook(name string, timeout time.Duration, fn func(ctx context.Context) error) *Shutdown {
+	s.Lock()
+	s.hooks = append(s.hooks, shutdownHook{name: name, timeout: timeout, fn: fn})
+	s.Unlock()
+	return s
+}
+
+// Listen start listening signals
+func (s *Shutdown) Listen() *Shutdown {
+	signals := s.signals
+	if s.reload != nil {
+		signals = append(append([]os.Signal(nil), signals...), s.reloadSignals...)
+	}
+	signal.Notify(s.sigchan, signals...)
+	go func() {
+		defer signal.Stop(s.sigchan)
+		for {
+			select {
+			case sig := <-s.sigchan:
+				if s.reload != nil && containsSignal(s.reloadSignals, sig) {
+					s.reload()
+					continue
+				}
+				s.Shutdown()
+				return
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Shutdown shutdown right now, it only runs once and returns errors of jobs and hooks
+func (s *Shutdown) Shutdown() error {
+	s.once.Do(func() {
+		s.err = s.shutdown()
+		close(s.done)
+	})
+	<-s.done
+	return s.err
+}
+
+// Wait wait shutdown done
+func (s *Shutdown) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Done closed when shutdown done
+func (s *Shutdown) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Shutdown) shutdown() error {
+	s.Lock()
+	jobs := append([]shutdownJob(nil), s.jobs...)
+	hooks := append([]shutdownHook(nil), s.hooks...)
+	s.Unlock()
+	var errs []string
+	levels, err := stopLevels(jobs)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, level := range levels {
+		if err := s.stopJobs(level); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, hook := range hooks {
+		if err := runHook(hook); err != nil {
+			errs = append(errs, fmt.Sprintf("hook %s: %v", hook.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *Shutdown) stopJobs(jobs []shutdownJob) error {
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		j.job.Stop()
+		wg.Add(1)
+		go func(job Stopper) {
+			defer wg.Done()
+			job.Wait()
+		}(j.job)
+	}
+	doneC := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(doneC)
+	}()
+	select {
+	case <-doneC:
+		return nil
+	case <-time.After(s.jobTimeout):
+		names := make([]string, len(jobs))
+		for i, j := range jobs {
+			names[i] = j.name
+		}
+		return fmt.Errorf("wait jobs %s stopped timeout", strings.Join(names, ","))
+	}
+}
+
+func runHook(hook shutdownHook) (err error) {
+	ctx := context.Background()
+	if hook.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.timeout)
+		defer cancel()
+	}
+	errC := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errC <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		errC <- hook.fn(ctx)
+	}()
+	select {
+	case err = <-errC:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// stopLevels group jobs into levels, jobs of a level only depend on jobs of later levels;
+// jobs in a dependency cycle are stopped together at last
+func stopLevels(jobs []shutdownJob) ([][]shutdownJob, error) {
+	known := make(map[string]bool)
+	for _, j := range jobs {
+		known[j.name] = true
+	}
+	// dependents count of every job
+	dependents := make(map[string]int)
+	for _, j := range jobs {
+		for _, dep := range j.dependsOn {
+			if known[dep] {
+				dependents[dep]++
+			}
+		}
+	}
+	var levels [][]shutdownJob
+	left := jobs
+	for len(left) > 0 {
+		var level, rest []shutdownJob
+		for _, j := range left {
+			if dependents[j.name] == 0 {
+				level = append(level, j)
+			} else {
+				rest = append(rest, j)
+			}
+		}
+		if len(level) == 0 {
+			names := make([]string, len(rest))
+			for i, j := range rest {
+				names[i] = j.name
+			}
+			return append(levels, rest), fmt.Errorf("dependency cycle among %s", strings.Join(names, ","))
+		}
+		for _, j := range level {
+			for _, dep := range j.dependsOn {
+				if known[dep] {
+					dependents[dep]--
+				}
+			}
+		}
+		levels = append(levels, level)
+		left = rest
+	}
+	return levels, nil
+}
+
+func containsSignal(list []os.Signal, sig os.Signal) bool {
+	for _, s := range list {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package redo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	var order []string
+	var mu sync.Mutex
+	record := func(name string) {
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+	job := func(name string) *Recipet {
+		started := make(chan struct{})
+		r := Perform(func(ctx *RedoCtx) {
+			close(started)
+			<-ctx.Context().Done()
+			record(name)
+		}, time.Hour)
+		<-started
+		return r
+	}
+	reloaded := make(chan struct{}, 1)
+	s := NewShutdown(syscall.SIGUSR1).
+		OnReload(func() { reloaded <- struct{}{} }).
+		Add("db", job("db")).
+		Add("consumer", job("consumer"), "db", "cache").
+		Add("cache", job("cache"), "db").
+		Hook("flush", time.Second, func(ctx context.Context) error {
+			record("flush")
+			return nil
+		}).
+		Hook("slow", 10*time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}).
+		Listen()
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("SIGHUP should reload")
+	}
+	select {
+	case <-s.Done():
+		t.Fatal("reload should not shutdown")
+	default:
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	err := s.Wait()
+	if err == nil || !strings.Contains(err.Error(), "hook slow") {
+		t.Fatalf("slow hook should timeout, got %v", err)
+	}
+	if strings.Join(order, ",") != "consumer,cache,db,flush" {
+		t.Fatalf("bad shutdown order %v", order)
+	}
+}
+
+func TestStopLevels(t *testing.T) {
+	levels, err := stopLevels([]shutdownJob{
+		{name: "a", dependsOn: []string{"b"}},
+		{name: "b", dependsOn: []string{"a"}},
+		{name: "c", dependsOn: []string{"unknown"}},
+	})
+	if err == nil || len(levels) != 2 || levels[0][0].name != "c" || len(levels[1]) != 2 {
+		t.Fatalf("cycle should be stopped at last %v %v", levels, err)
+	}
+}
+
+func TestShutdownPerformSafe(t *testing.T) {
+	r := PerformSafe(func(ctx *RedoCtx) {}, time.Hour)
+	reloaded := make(chan struct{}, 1)
+	s := NewShutdown(syscall.SIGUSR2).
+		OnReload(func() { reloaded <- struct{}{} }).
+		Add("safe", r).
+		Listen()
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("SIGHUP should reload")
+	}
+	select {
+	case <-r.WaitChan():
+		t.Fatal("SIGHUP should not stop job added to shutdown")
+	case <-time.After(50 * time.Millisecond):
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Wait() != STOP_USER {
+		t.Fatal("job should be stopped by shutdown")
+	}
+}
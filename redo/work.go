@@ -1,6 +1,8 @@
 package redo
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -12,22 +14,62 @@ import (
 // Job executable work
 type Job func(*RedoCtx)
 
+// ErrJob executable work which reports failure by error, convert it to Job by WrapErrJob
+type ErrJob func(*RedoCtx) error
+
 // RedoCtx redo context,control interval, stop now etc.
 type RedoCtx struct {
+	ctx                 context.Context
+	iteration           uint64
+	failures            int
+	err                 error
+	lastErr             error
+	lastDuration        time.Duration
 	delayBeforeNextLoop time.Duration
+	delaySet            bool
 	stopRedo            bool
 }
 
-func newCtx(duration time.Duration) *RedoCtx {
+func newCtx(ctx context.Context, iteration uint64, failures int, lastErr error, lastDuration time.Duration) *RedoCtx {
 	return &RedoCtx{
-		delayBeforeNextLoop: duration,
-		stopRedo:            false,
+		ctx:          ctx,
+		iteration:    iteration,
+		failures:     failures,
+		lastErr:      lastErr,
+		lastDuration: lastDuration,
+		stopRedo:     false,
 	}
 }
 
-// SetDelayBeforeNext set interval before next loop, only once affective
+// Context cancelled when job is requested to stop by Stop or caught signal, pass it to network I/O for prompt shutdown
+func (ctx *RedoCtx) Context() context.Context {
+	return ctx.ctx
+}
+
+// Iteration sequence number of this loop, starts from 1
+func (ctx *RedoCtx) Iteration() uint64 {
+	return ctx.iteration
+}
+
+// LastError error of last loop, nil if last loop succeeded or this is the first loop
+func (ctx *RedoCtx) LastError() error {
+	return ctx.lastErr
+}
+
+// ConsecutiveFailures count of consecutive failed loops before this one
+func (ctx *RedoCtx) ConsecutiveFailures() int {
+	return ctx.failures
+}
+
+// LastDuration execution time of last loop
+func (ctx *RedoCtx) LastDuration() time.Duration {
+	return ctx.lastDuration
+}
+
+// SetDelayBeforeNext set interval before next loop, only once affective, it overrides the schedule
 func (ctx *RedoCtx) SetDelayBeforeNext(new_duration time.Duration) {
 	ctx.delayBeforeNextLoop = new_duration
+	ctx.delaySet = true
 }
 
 // StartNextRightNow start next loop right now
@@ -47,57 +89,193 @@ func WrapFunc(work func()) Job {
 	}
 }
 
+// WrapErrJob helper function convert ErrJob to Job, returned error counts as failure of the loop
+func WrapErrJob(work ErrJob) Job {
+	return func(ctx *RedoCtx) {
+		ctx.err = work(ctx)
+	}
+}
+
 // perform job without gracefull exit
-func Perform(once Job, duration time.Duration) *Recipet {
-	return performWork(once, duration, false)
+func Perform(once Job, duration time.Duration, opts ...Option) *Recipet {
+	opt := newOptions(opts)
+	return performWork(once, intervalSchedule{interval: duration, fixedRate: opt.fixedRate}, time.Now(), opt)
 }
 
 // perform job with gracefull exit
-func PerformSafe(once Job, duration time.Duration) *Recipet {
-	return performWork(once, duration, true)
+func PerformSafe(once Job, duration time.Duration, opts ...Option) *Recipet {
+	return Perform(once, duration, append(opts, WithCatchSignal())...)
 }
 
-func performWork(once Job, duration time.Duration, catchSignal bool) *Recipet {
-	onceFunc := func(ctx *RedoCtx) {
+// PerformCron perform job at time matched by cron spec, see ParseCron for spec syntax
+func PerformCron(once Job, spec string, opts ...Option) (*Recipet, error) {
+	opt := newOptions(opts)
+	sched, err := parseCron(spec, opt.location)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return performWork(once, sched, sched.Next(now, now), opt), nil
+}
+
+// PerformSchedule perform job by custom schedule, first loop starts at Next(now, now)
+func PerformSchedule(once Job, sched Schedule, opts ...Option) *Recipet {
+	now := time.Now()
+	return performWork(once, sched, sched.Next(now, now), newOptions(opts))
+}
+
+func performWork(once Job, sched Schedule, firstRun time.Time, opt *options) *Recipet {
+	onceFunc := func(ctx *RedoCtx) (err error) {
 		defer func() {
 			if r := recover(); r != nil {
 				buf := make([]byte, 1<<16)
-				runtime.Stack(buf, false)
-				log.Printf("panic occur:%+v\nstacktrace:%s\n", r, string(buf))
+				buf = buf[:runtime.Stack(buf, false)]
+				if opt.panicHook != nil {
+					opt.panicHook(r, buf)
+				} else {
+					log.Printf("panic occur:%+v\nstacktrace:%s\n", r, string(buf))
+				}
+				err = fmt.Errorf("panic: %v", r)
 			}
 		}()
 		once(ctx)
+		if err = ctx.err; err != nil && opt.errorHook != nil {
+			opt.errorHook(ctx, err)
+		}
+		return
+	}
+	parent := opt.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	recipet := newRecipet(parent)
+	recipet.skipRunning = opt.skipRunning
+	if opt.catchSignal {
+		recipet.catchSignals(opt.signals...)
+	}
+	if opt.ctx != nil {
+		go func(m *Recipet) {
+			select {
+			case <-opt.ctx.Done():
+				m.stopWithRequest(STOP_USER)
+			case <-m.done:
+			}
+		}(recipet)
 	}
-	recipet := newRecipet()
-	recipet.catchSignal = catchSignal
 	go func(m *Recipet) {
-		if catchSignal {
-			batchCatchSignals(m.sigchan)
-		}
+		next := firstRun
+		// tick of next loop for locker, zero if next loop is not planned by schedule
+		tick := tickOf(sched, firstRun)
+		var iteration uint64
+		var failures int
+		var lastErr error
+		var lastDuration time.Duration
 		for {
-			ctx := newCtx(duration)
-			onceFunc(ctx)
+			if !next.IsZero() {
+				delay := time.Until(next) + opt.jitterDelay()
+				m.markSleeping(time.Now().Add(delay))
+				woken, ok := m.waitNext(delay)
+				if !ok {
+					return
+				}
+				if woken {
+					tick = time.Time{}
+				}
+			}
+			var release func(error)
+			if opt.locker != nil {
+				var locked bool
+				var err error
+				if release, locked, err = opt.locker.Lock(m.ctx, tick); !locked {
+					if err != nil {
+						log.Printf("lock job fail:%v", err)
+					}
+					m.markSkipped()
+					now := time.Now()
+					if next = sched.Next(now, now); next.IsZero() {
+						log.Printf("no more loop scheduled, stop job")
+						m.Stop()
+						next = now
+					}
+					tick = tickOf(sched, next)
+					continue
+				}
+			}
+			iteration++
+			ctx := newCtx(m.ctx, iteration, failures, lastErr, lastDuration)
+			start := time.Now()
+			m.markRunning(start)
+			if lastErr = onceFunc(ctx); lastErr != nil {
+				failures++
+			} else {
+				failures = 0
+			}
+			if release != nil {
+				release(lastErr)
+			}
+			if opt.maxFailures > 0 && failures >= opt.maxFailures {
+				m.stopWithRequest(STOP_FAILURE)
+			}
 			if ctx.stopRedo {
 				m.Stop()
 			}
-
-			select {
-			case <-m.requestStopChan():
-				m.closeChannels()
-				return
-			case <-m.sigchan:
-				signal.Stop(m.sigchan)
-				m.stopWithRequest(STOP_SYS)
-				m.closeChannels()
-				return
-			case <-time.After(ctx.delayBeforeNextLoop):
-			case <-m.wakeupChan():
+			end := time.Now()
+			lastDuration = end.Sub(start)
+			m.markDone(lastErr, failures, lastDuration)
+			if ctx.delaySet {
+				next = end.Add(ctx.delayBeforeNextLoop)
+				tick = time.Time{}
+			} else if failures > 0 && opt.backoff != nil {
+				// retry belongs to the failed tick
+				next = end.Add(opt.backoff.Next(failures))
+			} else if next = sched.Next(start, end); next.IsZero() {
+				log.Printf("no more loop scheduled, stop job")
+				m.Stop()
+				next = end
+			} else {
+				tick = tickOf(sched, next)
 			}
 		}
 	}(recipet)
 	return recipet
 }
 
+// waitNext wait until timeout or wakeup, a due loop of paused job waits for Resume;
+// woken is true if it's waked up by Wakeup, ok is false if job is stopped
+func (m *Recipet) waitNext(delay time.Duration) (woken bool, ok bool) {
+	if delay < 0 {
+		delay = 0
+	}
+	// stop request takes precedence over due loop
+	select {
+	case <-m.requestStopChan():
+		m.closeChannels()
+		return false, false
+	default:
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	timerC := timer.C
+	for {
+		select {
+		case <-m.requestStopChan():
+			m.closeChannels()
+			return false, false
+		case <-timerC:
+			if !m.isPaused() {
+				return false, true
+			}
+			timerC = nil
+		case <-m.resumeC:
+			if timerC == nil {
+				return false, true
+			}
+		case <-m.wakeupChan():
+			return true, true
+		}
+	}
+}
+
 func batchCatchSignals(sigchan chan os.Signal) {
 	signal.Notify(sigchan, syscall.SIGABRT, syscall.SIGALRM, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 }
@@ -0,0 +1,120 @@
+package redo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRedoCtx(t *testing.T) {
+	type loop struct {
+		iteration uint64
+		lastErr   error
+	}
+	loops := make(chan loop, 10)
+	started := make(chan struct{})
+	rep := Perform(func(ctx *RedoCtx) {
+		loops <- loop{iteration: ctx.Iteration(), lastErr: ctx.LastError()}
+		switch ctx.Iteration() {
+		case 1:
+			panic("boom")
+		case 2:
+			ctx.StartNextRightNow()
+		default:
+			close(started)
+			// long running job should notice stop
+			select {
+			case <-ctx.Context().Done():
+			case <-time.After(5 * time.Second):
+				t.Error("context should be cancelled by stop")
+			}
+		}
+	}, time.Millisecond)
+	<-started
+	begin := time.Now()
+	rep.Stop()
+	rep.Wait()
+	if time.Since(begin) > time.Second {
+		t.Fatal("stop should be prompt")
+	}
+	close(loops)
+	var list []loop
+	for l := range loops {
+		list = append(list, l)
+	}
+	if len(list) != 3 || list[0].iteration != 1 || list[2].iteration != 3 {
+		t.Fatalf("bad iterations %v", list)
+	}
+	if list[0].lastErr != nil || list[1].lastErr == nil || list[2].lastErr != nil {
+		t.Fatalf("bad last error %v", list)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	rep := Perform(func(rc *RedoCtx) {
+		if rc.Iteration() == 1 {
+			close(started)
+		}
+		select {
+		case <-rc.Context().Done():
+		case <-time.After(5 * time.Second):
+			t.Error("context should be cancelled by parent")
+		}
+	}, time.Millisecond, WithContext(ctx))
+	<-started
+	begin := time.Now()
+	cancel()
+	rep.Wait()
+	if time.Since(begin) > time.Second {
+		t.Fatal("cancel of parent should stop job promptly")
+	}
+}
+
+func TestErrJobBackoff(t *testing.T) {
+	var panics, errs int
+	var failures []int
+	rep := Perform(WrapErrJob(func(ctx *RedoCtx) error {
+		failures = append(failures, ctx.ConsecutiveFailures())
+		if ctx.Iteration() == 1 {
+			panic("boom")
+		}
+		return errors.New("fail")
+	}), time.Hour,
+		WithBackoff(ConstantBackoff(10*time.Millisecond)),
+		WithMaxFailures(3),
+		WithPanicHook(func(r interface{}, stack []byte) { panics++ }),
+		WithErrorHook(func(ctx *RedoCtx, err error) { errs++ }),
+	)
+	select {
+	case <-rep.WaitChan():
+	case <-time.After(time.Second):
+		t.Fatal("failed loops should retry by backoff instead of interval")
+	}
+	if tp := rep.Wait(); tp != STOP_FAILURE {
+		t.Fatalf("bad stop type %v", tp)
+	}
+	if len(failures) != 3 || failures[0] != 0 || failures[2] != 2 {
+		t.Fatalf("bad failures %v", failures)
+	}
+	if panics != 1 || errs != 2 {
+		t.Fatalf("bad hooks panics=%d errors=%d", panics, errs)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := NewExponentialBackoff(time.Second, 10*time.Second)
+	for failures, expect := range []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if d := b.Next(failures); d != expect {
+			t.Fatalf("failures %d: expect %v got %v", failures, expect, d)
+		}
+	}
+	b.WithJitter(0.5)
+	for i := 0; i < 100; i++ {
+		if d := b.Next(3); d < 2*time.Second || d > 4*time.Second {
+			t.Fatalf("jitter out of range %v", d)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package uid
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// AtomicWorker lock-free worker safe for concurrent use, state(timestamp and sequence) is updated by CAS;
+// when sequence of current millisecond runs out it borrows following milliseconds instead of busy waiting
+type AtomicWorker struct {
+	layout       Layout
+	datacenterId int
+	serverId     int
+	// (timestamp-epoch)<<SequenceBits | sequence, increasing it by 1 carries sequence overflow into timestamp
+	state   uint64
+	borrow  int64 // ms
+	maxWait int64 // ms
+	clock   func() int64
+}
+
+// NewAtomicWorker create lock-free worker of layout
+func NewAtomicWorker(layout Layout, datacenterId, serverId int) (*AtomicWorker, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	if datacenterId < 0 || layout.MaxDatacenter() < datacenterId {
+		return nil, fmt.Errorf("invalid datacenter Id")
+	}
+	if serverId < 0 || layout.MaxServer() < serverId {
+		return nil, fmt.Errorf("invalid server Id")
+	}
+	return &AtomicWorker{
+		layout:       layout,
+		datacenterId: datacenterId,
+		serverId:     serverId,
+		borrow:       10,
+		maxWait:      1000,
+		clock:        now,
+	}, nil
+}
+
+// Borrow set how far timestamp could run ahead of system clock, default 10ms;
+// generating waits once it's exceeded and fails if waiting would be longer than maxWait(default 1s)
+func (w *AtomicWorker) Borrow(borrow, maxWait time.Duration) *AtomicWorker {
+	if borrow >= 0 {
+		w.borrow = int64(borrow / time.Millisecond)
+	}
+	if maxWait >= 0 {
+		w.maxWait = int64(maxWait / time.Millisecond)
+	}
+	return w
+}
+
+// Gen generate id
+func (w *AtomicWorker) Gen() (int64, error) {
+	state, err := w.reserve(1)
+	if err != nil {
+		return -1, err
+	}
+	return w.compose(state), nil
+}
+
+// GenN generate n ids in a single reservation, ids are increasing and contiguous in (timestamp, sequence) space;
+// if n is more than sequences of borrowed milliseconds, reservation runs ahead further and GenN waits
+// until the clock catches up, which is about n/(1<<SequenceBits) ms
+func (w *AtomicWorker) GenN(n int) ([]int64, error) {
+	if n <= 0 {
+		return nil, errors.New("n should be positive")
+	}
+	last, err := w.reserve(uint64(n))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, n)
+	first := last - uint64(n) + 1
+	for i := range ids {
+		ids[i] = w.compose(first + uint64(i))
+	}
+	return ids, nil
+}
+
+// reserve n states, return the last one; n states take (n-1)>>SequenceBits more milliseconds than borrow,
+// it returns after the clock catches up with them
+func (w *AtomicWorker) reserve(n uint64) (uint64, error) {
+	seqBits := uint(w.layout.SequenceBits)
+	extra := int64((n - 1) >> seqBits)
+	for {
+		t := w.clock() - w.layout.Epoch
+		if t < 0 {
+			return 0, errors.New("invalid system clock")
+		}
+		old := atomic.LoadUint64(&w.state)
+		next := old + n
+		if floor := uint64(t)<<seqBits + n - 1; next < floor {
+			next = floor
+		}
+		ts := int64(next >> seqBits)
+		if ts >= 1<<uint(w.layout.TimeBits()) {
+			return 0, fmt.Errorf("timestamp overflow")
+		}
+		ahead := ts - t
+		if wait := ahead - w.borrow - extra; wait > 0 {
+			if wait > w.maxWait {
+				return 0, fmt.Errorf("invalid system clock, %dms behind generated ids", ahead)
+			}
+			time.Sleep(time.Duration(wait) * time.Millisecond)
+			continue
+		}
+		if atomic.CompareAndSwapUint64(&w.state, old, next) {
+			if ahead > w.borrow {
+				time.Sleep(time.Duration(ahead-w.borrow) * time.Millisecond)
+			}
+			return next, nil
+		}
+	}
+}
+
+func (w *AtomicWorker) compose(state uint64) int64 {
+	seqBits := uint(w.layout.SequenceBits)
+	ts := int64(state>>seqBits) + w.layout.Epoch
+	return w.layout.Compose(ts, w.datacenterId, w.serverId, int(state&uint64(w.layout.MaxSequence())))
+}
+
+// InitAtomicGenerator use lock-free worker as the generator of GenNumId and GenUniqueId
+func InitAtomicGenerator(layout Layout, datacenterId, serverId int) error {
+	w, err := NewAtomicWorker(layout, datacenterId, serverId)
+	if err != nil {
+		return err
+	}
+	g_uid = w
+	return nil
+}
+
+// GenNumIds generate n ids by generator of InitAtomicGenerator in a single reservation
+func GenNumIds(n int) ([]int64, error) {
+	w, ok := g_uid.(*AtomicWorker)
+	if !ok {
+		return nil, errors.New("atomic id generator not initilized")
+	}
+	return w.GenN(n)
+}
@@ -0,0 +1,228 @@
+package uid
+
+import (
+	"crypto/rand"
+	"errors"
+	"sync"
+)
+
+const (
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	base32Alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ" // crockford
+)
+
+var (
+	base62Decode = decodeTable(base62Alphabet, false)
+	base32Decode = decodeTable(base32Alphabet, true)
+)
+
+func decodeTable(alphabet string, crockford bool) [256]int8 {
+	var table [256]int8
+	for i := range table {
+		table[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		table[alphabet[i]] = int8(i)
+	}
+	if crockford {
+		for i := 0; i < len(alphabet); i++ {
+			if c := alphabet[i]; c >= 'A' && c <= 'Z' {
+				table[c+'a'-'A'] = int8(i)
+			}
+		}
+		table['I'], table['i'], table['L'], table['l'] = 1, 1, 1, 1
+		table['O'], table['o'] = 0, 0
+	}
+	return table
+}
+
+// encodeBase encode big-endian number into fixed width string, so that order of strings is order of numbers
+func encodeBase(src []byte, alphabet string, width int) string {
+	base := uint32(len(alphabet))
+	num := append([]byte(nil), src...)
+	out := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		// num, remainder = num / base, num % base
+		var rem uint32
+		for j := range num {
+			acc := rem<<8 | uint32(num[j])
+			num[j] = byte(acc / base)
+			rem = acc % base
+		}
+		out[i] = alphabet[rem]
+	}
+	return string(out)
+}
+
+// decodeBase decode fixed width string into size bytes big-endian number
+func decodeBase(s string, table *[256]int8, base uint32, width, size int) ([]byte, error) {
+	if len(s) != width {
+		return nil, errors.New("bad length")
+	}
+	dst := make([]byte, size)
+	for i := 0; i < len(s); i++ {
+		d := table[s[i]]
+		if d < 0 {
+			return nil, errors.New("bad character")
+		}
+		// dst = dst * base + d
+		carry := uint32(d)
+		for j := size - 1; j >= 0; j-- {
+			acc := uint32(dst[j])*base + carry
+			dst[j] = byte(acc)
+			carry = acc >> 8
+		}
+		if carry != 0 {
+			return nil, errors.New("value overflow")
+		}
+	}
+	return dst, nil
+}
+
+func int64Bytes(n int64) []byte {
+	b := make([]byte, 8)
+	for i := 7; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+	return b
+}
+
+func bytesInt64(b []byte) int64 {
+	var n int64
+	for _, c := range b {
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+// EncodeBase62 encode id into 11 chars base62, sortable as id
+func EncodeBase62(id int64) string {
+	return encodeBase(int64Bytes(id), base62Alphabet, 11)
+}
+
+// DecodeBase62 decode id encoded by EncodeBase62
+func DecodeBase62(s string) (int64, error) {
+	b, err := decodeBase(s, &base62Decode, 62, 11, 8)
+	if err != nil {
+		return 0, err
+	}
+	if b[0]&0x80 != 0 {
+		return 0, errors.New("value overflow")
+	}
+	return bytesInt64(b), nil
+}
+
+// ValidBase62 check s is an id encoded by EncodeBase62
+func ValidBase62(s string) bool {
+	_, err := DecodeBase62(s)
+	return err == nil
+}
+
+// EncodeBase32 encode id into 13 chars crockford base32, sortable as id
+func EncodeBase32(id int64) string {
+	return encodeBase(int64Bytes(id), base32Alphabet, 13)
+}
+
+// DecodeBase32 decode id encoded by EncodeBase32, it's case insensitive and I/L/O are read as 1/1/0
+func DecodeBase32(s string) (int64, error) {
+	b, err := decodeBase(s, &base32Decode, 32, 13, 8)
+	if err != nil {
+		return 0, err
+	}
+	if b[0]&0x80 != 0 {
+		return 0, errors.New("value overflow")
+	}
+	return bytesInt64(b), nil
+}
+
+// ValidBase32 check s is an id encoded by EncodeBase32, aliases accepted by DecodeBase32 are valid
+func ValidBase32(s string) bool {
+	_, err := DecodeBase32(s)
+	return err == nil
+}
+
+// GenBase62Id generate id by GenNumId generator and encode it by EncodeBase62
+func GenBase62Id() (string, error) {
+	if g_uid == nil {
+		return "", errors.New("id generator not initilized")
+	}
+	id, err := g_uid.Gen()
+	if err != nil {
+		return "", err
+	}
+	return EncodeBase62(id), nil
+}
+
+// GenBase32Id generate id by GenNumId generator and encode it by EncodeBase32
+func GenBase32Id() (string, error) {
+	if g_uid == nil {
+		return "", errors.New("id generator not initilized")
+	}
+	id, err := g_uid.Gen()
+	if err != nil {
+		return "", err
+	}
+	return EncodeBase32(id), nil
+}
+
+// monotonic timestamp and random entropy, entropy increases within the same timestamp
+// and timestamp never goes backwards, so that ids are strictly increasing in process
+type monotonic struct {
+	last    int64
+	entropy []byte
+	topMask byte
+	*sync.Mutex
+}
+
+// newMonotonic entropy of bits
+func newMonotonic(bits int) *monotonic {
+	size := (bits + 7) / 8
+	return &monotonic{
+		entropy: make([]byte, size),
+		topMask: byte(0xff >> uint(size*8-bits)),
+		Mutex:   new(sync.Mutex),
+	}
+}
+
+func (m *monotonic) next(ts int64) (int64, []byte) {
+	m.Lock()
+	defer m.Unlock()
+	if ts > m.last {
+		m.last = ts
+		m.random()
+	} else if !m.increment() {
+		// entropy exhausted, move logical clock forward
+		m.last++
+		m.random()
+	}
+	return m.last, append([]byte(nil), m.entropy...)
+}
+
+func (m *monotonic) random() {
+	if _, err := rand.Read(m.entropy); err != nil {
+		panic(err)
+	}
+	m.entropy[0] &= m.topMask
+	// leave room for increments
+	m.entropy[0] &^= byte((int(m.topMask) + 1) >> 1)
+}
+
+func (m *monotonic) increment() bool {
+	for i := len(m.entropy) - 1; i >= 0; i-- {
+		m.entropy[i]++
+		if m.entropy[i] != 0 {
+			break
+		}
+	}
+	return m.entropy[0]&^m.topMask == 0 && !m.allZero()
+}
+
+func (m *monotonic) allZero() bool {
+	for _, b := range m.entropy {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package etcdleaser
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uid "github.com/qjpcpu/common/unique-id"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+// Leaser lease worker id by key <prefix>/<id> bound to an etcd lease, last timestamp of id is kept by key <prefix>/<id>/last
+type Leaser struct {
+	cli     *clientv3.Client
+	prefix  string
+	ttl     int64
+	leaseID clientv3.LeaseID
+	*sync.Mutex
+}
+
+// New create leaser, ttl is in seconds
+func New(cli *clientv3.Client, prefix string, ttl int) *Leaser {
+	if ttl <= 0 {
+		ttl = 10
+	}
+	return &Leaser{
+		cli:    cli,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		ttl:    int64(ttl),
+		Mutex:  new(sync.Mutex),
+	}
+}
+
+// TTL lease ttl
+func (l *Leaser) TTL() time.Duration {
+	return time.Duration(l.ttl) * time.Second
+}
+
+// Acquire claim a free id in [0,max], return last timestamp of id
+func (l *Leaser) Acquire(ctx context.Context, max int, until int64) (int, int64, error) {
+	lease, err := l.cli.Grant(ctx, l.ttl)
+	if err != nil {
+		return -1, 0, err
+	}
+	// start from random id so that instances don't compete for the same id
+	start := int(time.Now().UnixNano() % int64(max+1))
+	for i := 0; i <= max; i++ {
+		id := (start + i) % (max + 1)
+		key := l.key(id)
+		resp, err := l.cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, "", clientv3.WithLease(lease.ID)), clientv3.OpGet(key+"/last")).
+			Commit()
+		if err != nil {
+			l.revoke(lease.ID)
+			return -1, 0, err
+		}
+		if !resp.Succeeded {
+			continue
+		}
+		var last int64
+		if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) > 0 {
+			last, _ = strconv.ParseInt(string(kvs[0].Value), 10, 64)
+		}
+		if last < until {
+			err = l.keepLast(ctx, id, lease.ID, until)
+		}
+		if err != nil {
+			l.revoke(lease.ID)
+			return -1, 0, err
+		}
+		l.Lock()
+		l.leaseID = lease.ID
+		l.Unlock()
+		return id, last, nil
+	}
+	l.revoke(lease.ID)
+	return -1, 0, errors.New("no free worker id")
+}
+
+// Renew keep lease alive and keep until as last timestamp
+func (l *Leaser) Renew(ctx context.Context, id int, until int64) error {
+	l.Lock()
+	leaseID := l.leaseID
+	l.Unlock()
+	if leaseID == clientv3.NoLease {
+		return uid.ErrLeaseLost
+	}
+	if _, err := l.cli.KeepAliveOnce(ctx, leaseID); err != nil {
+		if err == rpctypes.ErrLeaseNotFound {
+			return uid.ErrLeaseLost
+		}
+		return err
+	}
+	return l.keepLast(ctx, id, leaseID, until)
+}
+
+// Release keep last timestamp and revoke lease, key of id is deleted with it
+func (l *Leaser) Release(ctx context.Context, id int, last int64) error {
+	l.Lock()
+	leaseID := l.leaseID
+	l.leaseID = clientv3.NoLease
+	l.Unlock()
+	if leaseID == clientv3.NoLease {
+		return nil
+	}
+	if err := l.keepLast(ctx, id, leaseID, last); err != nil && err != uid.ErrLeaseLost {
+		return err
+	}
+	_, err := l.cli.Revoke(ctx, leaseID)
+	return err
+}
+
+// keepLast put last timestamp of id if id is still held by lease
+func (l *Leaser) keepLast(ctx context.Context, id int, leaseID clientv3.LeaseID, last int64) error {
+	key := l.key(id)
+	resp, err := l.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.LeaseValue(key), "=", leaseID)).
+		Then(clientv3.OpPut(key+"/last", strconv.FormatInt(last, 10))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return uid.ErrLeaseLost
+	}
+	return nil
+}
+
+func (l *Leaser) key(id int) string {
+	return l.prefix + "/" + strconv.Itoa(id)
+}
+
+func (l *Leaser) revoke(leaseID clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	l.cli.Revoke(ctx, leaseID)
+}
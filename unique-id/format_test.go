@@ -0,0 +1,76 @@
+package uid
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBaseEncoding(t *testing.T) {
+	ids := []int64{0, 1, 61, 62, 1 << 40, math.MaxInt64}
+	var b62, b32 []string
+	for _, id := range ids {
+		s := EncodeBase62(id)
+		if n, err := DecodeBase62(s); err != nil || n != id {
+			t.Fatalf("base62 %d -> %s -> %d %v", id, s, n, err)
+		}
+		b62 = append(b62, s)
+		s = EncodeBase32(id)
+		if n, err := DecodeBase32(strings.ToLower(s)); err != nil || n != id {
+			t.Fatalf("base32 %d -> %s -> %d %v", id, s, n, err)
+		}
+		b32 = append(b32, s)
+	}
+	if !sort.StringsAreSorted(b62) || !sort.StringsAreSorted(b32) {
+		t.Fatal("encoding should keep order")
+	}
+	if _, err := DecodeBase62("zzzzzzzzzzz"); err == nil {
+		t.Fatal("overflow")
+	}
+	if _, err := DecodeBase32("0000000000I0L"); err != nil {
+		t.Fatal("crockford aliases", err)
+	}
+	if _, err := DecodeBase32("000000000000U"); err == nil {
+		t.Fatal("U is not crockford")
+	}
+	if !ValidBase62(EncodeBase62(42)) || ValidBase62("zzzzzzzzzzz") || ValidBase62("0000000000") || ValidBase62("000000000-0") {
+		t.Fatal("bad base62 validation")
+	}
+	if !ValidBase32(EncodeBase32(42)) || !ValidBase32("0000000000I0L") || ValidBase32("000000000000U") || ValidBase32("0") {
+		t.Fatal("bad base32 validation")
+	}
+}
+
+func TestFormats(t *testing.T) {
+	var last [3]string
+	for i := 0; i < 10000; i++ {
+		u, v, k := NewULID(), NewUUIDv7(), NewKSUID()
+		cur := [3]string{u.String(), v.String(), k.String()}
+		for j := range cur {
+			if cur[j] <= last[j] {
+				t.Fatalf("format %d should be increasing: %s <= %s", j, cur[j], last[j])
+			}
+		}
+		last = cur
+	}
+	u := NewULID()
+	if p, err := ParseULID(strings.ToLower(u.String())); err != nil || p != u || time.Since(u.Time()) > time.Second {
+		t.Fatalf("bad ulid %s %v", u, err)
+	}
+	v := NewUUIDv7()
+	if p, err := ParseUUIDv7(v.String()); err != nil || p != v || v.Version() != 7 || time.Since(v.Time()) > time.Second {
+		t.Fatalf("bad uuid %s %v", v, err)
+	}
+	k := NewKSUID()
+	if p, err := ParseKSUID(k.String()); err != nil || p != k || time.Since(k.Time()) > 2*time.Second {
+		t.Fatalf("bad ksuid %s %v", k, err)
+	}
+	if ValidULID("8ZZZZZZZZZZZZZZZZZZZZZZZZZ") || ValidUUIDv7("6ba7b810-9dad-11d1-80b4-00c04fd430c8") || ValidKSUID("aWgEPTl1tmebfsQzFP4bxwgy80") {
+		t.Fatal("invalid ids")
+	}
+	if !ValidKSUID("0ujtsYcgvSTl8PAuAdqWYSMnLOv") || !ValidULID("01ARZ3NDEKTSV4RRFFQ69G5FAV") {
+		t.Fatal("valid ids")
+	}
+}
@@ -20,7 +20,12 @@ const ServerMax int = -1 ^ (-1 << ServerBits)
 
 const SequenceMask int32 = -1 ^ (-1 << SequenceBits)
 
-var g_uid *GUID
+// Generator numeric id generator, both GUID and LeaseGenerator are generators
+type Generator interface {
+	Gen() (int64, error)
+}
+
+var g_uid Generator
 
 ///  public API start
 
@@ -50,39 +55,96 @@ func GenNumId() (string, error) {
 	}
 }
 
+// InitLayoutGenerator 同InitGenerator, 使用自定义的epoch和位分配
+func InitLayoutGenerator(layout Layout, datacenterId, serverId, workerNum int) error {
+	g, err := NewLayoutGUID(layout, datacenterId, serverId, workerNum)
+	if err != nil {
+		return err
+	}
+	g_uid = g
+	return nil
+}
+
 /// public API end
 
 type Worker struct {
+	layout        Layout
+	datacenterId  int
 	serverId      int
 	lastTimestamp int64
 	sequence      int32
+	skewWait      int64 // ms
+	skewMax       int64 // ms
+	skew          SkewStats
+	clock         func() int64
 }
 
 type GUID struct {
 	workers chan *Worker
+	all     []*Worker
 }
 
 func NewWorker(serverId int) *Worker {
-	if serverId < 0 || ServerMax < serverId {
-		panic(fmt.Errorf("invalid server Id"))
+	w, err := NewLayoutWorker(DefaultLayout, 0, serverId)
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// NewLayoutWorker worker of custom layout
+func NewLayoutWorker(layout Layout, datacenterId, serverId int) (*Worker, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	if datacenterId < 0 || layout.MaxDatacenter() < datacenterId {
+		return nil, fmt.Errorf("invalid datacenter Id")
+	}
+	if serverId < 0 || layout.MaxServer() < serverId {
+		return nil, fmt.Errorf("invalid server Id")
 	}
 	return &Worker{
+		layout:        layout,
+		datacenterId:  datacenterId,
 		serverId:      serverId,
 		lastTimestamp: 0,
 		sequence:      0,
-	}
+		clock:         now,
+	}, nil
 }
 
 func NewGUID(serverId, serverNum int) *GUID {
 	workers := make(chan *Worker, serverNum)
+	all := make([]*Worker, 0, serverNum)
 	for n := 0; n < serverNum; n++ {
-		workers <- NewWorker(serverId + n)
+		w := NewWorker(serverId + n)
+		workers <- w
+		all = append(all, w)
 	}
 	return &GUID{
 		workers: workers,
+		all:     all,
 	}
 }
 
+// NewLayoutGUID workers of server id [serverId,serverId+serverNum) in datacenter
+func NewLayoutGUID(layout Layout, datacenterId, serverId, serverNum int) (*GUID, error) {
+	workers := make(chan *Worker, serverNum)
+	all := make([]*Worker, 0, serverNum)
+	for n := 0; n < serverNum; n++ {
+		w, err := NewLayoutWorker(layout, datacenterId, serverId+n)
+		if err != nil {
+			return nil, err
+		}
+		workers <- w
+		all = append(all, w)
+	}
+	return &GUID{
+		workers: workers,
+		all:     all,
+	}, nil
+}
+
 func (s *GUID) Gen() (int64, error) {
 	worker := <-s.workers
 	id, err := worker.Next()
@@ -91,31 +153,38 @@ func (s *GUID) Gen() (int64, error) {
 }
 
 func (s *Worker) Next() (int64, error) {
-	t := now()
+	t := s.clock()
 	if t < s.lastTimestamp {
-		return -1, fmt.Errorf("invalid system clock")
+		var err error
+		if t, err = s.tolerate(t); err != nil {
+			return -1, err
+		}
 	}
+	var seq int32
 	if t == s.lastTimestamp {
-		s.sequence = (s.sequence + 1) & SequenceMask
-		if s.sequence == 0 {
+		seq = (s.sequence + 1) & int32(s.layout.MaxSequence())
+		if seq == 0 {
 			t = s.nextMillis()
 		}
-	} else {
-		s.sequence = 0
 	}
+	// check overflow before mutating, so a failed call leaves worker untouched
+	if t-s.layout.Epoch >= 1<<uint(s.layout.TimeBits()) {
+		return -1, fmt.Errorf("timestamp overflow")
+	}
+	s.sequence = seq
 	s.lastTimestamp = t
-	tp := (t - Epoch) << TimeShift
-	sp := int64(s.serverId << ServerShift)
-	n := tp | sp | int64(s.sequence)
-
-	return n, nil
+	return s.layout.Compose(t, s.datacenterId, s.serverId, int(s.sequence)), nil
 }
 
 func (s *Worker) nextMillis() int64 {
-	t := now()
+	t := s.clock()
+	if t < s.lastTimestamp {
+		// logical clock is ahead of system clock, move it forward instead of waiting
+		return s.lastTimestamp + 1
+	}
 	for t <= s.lastTimestamp {
 		time.Sleep(100 * time.Microsecond)
-		t = now()
+		t = s.clock()
 	}
 	return t
 }
@@ -2,6 +2,7 @@ package uid
 
 import (
 	"testing"
+	"time"
 )
 
 func BenchmarkGenId(b *testing.B) {
@@ -19,3 +20,213 @@ func BenchmarkGenId(b *testing.B) {
 		}
 	}
 }
+
+func TestLayout(t *testing.T) {
+	layout := Layout{Epoch: 1577836800000, DatacenterBits: 3, ServerBits: 7, SequenceBits: 12}
+	w, err := NewLayoutWorker(layout, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := now()
+	id, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := layout.Decompose(id)
+	if p.Datacenter != 5 || p.Server != 100 || p.Sequence != 0 || p.Timestamp < before || p.Timestamp > now() {
+		t.Fatalf("bad parts %+v", p)
+	}
+	if _, err := NewLayoutWorker(layout, 8, 0); err == nil {
+		t.Fatal("datacenter out of range")
+	}
+	if err := (Layout{ServerBits: 20, SequenceBits: 20}).Validate(); err == nil {
+		t.Fatal("too few timestamp bits")
+	}
+	if err := (Layout{Epoch: now() + 1000, SequenceBits: 12}).Validate(); err == nil {
+		t.Fatal("epoch in future")
+	}
+	// default layout is compatible with legacy ids
+	id, _ = NewWorker(12).Next()
+	if p := Decompose(id); p.Server != 12 || id>>TimeShift != p.Timestamp-Epoch {
+		t.Fatalf("bad default parts %+v", p)
+	}
+}
+
+func TestSkewTolerance(t *testing.T) {
+	clock := now()
+	w := NewWorker(1)
+	w.clock = func() int64 { return clock }
+	last, _ := w.Next()
+	clock -= 5
+	if _, err := w.Next(); err == nil {
+		t.Fatal("skew should fail without tolerance")
+	}
+	w.SkewTolerance(0, 10*time.Millisecond)
+	for i := 0; i < 5000; i++ {
+		id, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= last {
+			t.Fatal("id should be increasing by logical clock")
+		}
+		last = id
+	}
+	clock -= 20
+	if _, err := w.Next(); err == nil {
+		t.Fatal("skew beyond max should fail")
+	}
+	// small skew is waited out
+	w.clock = now
+	w.lastTimestamp = now() + 3
+	w.SkewTolerance(5*time.Millisecond, 0)
+	if id, err := w.Next(); err != nil || id <= last {
+		t.Fatalf("should wait out skew %v", err)
+	}
+	st := w.SkewStats()
+	if st.Waited != 1 || st.Logical != 5000 || st.Rejected != 2 || st.MaxSkew < 20 {
+		t.Fatalf("bad stats %+v", st)
+	}
+}
+
+func TestTimestampOverflow(t *testing.T) {
+	layout := Layout{Epoch: now() - 100, SequenceBits: 2, ServerBits: 1}
+	w, err := NewLayoutWorker(layout, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := layout.Epoch + 1<<uint(layout.TimeBits())
+	clock := limit - 1
+	w.clock = func() int64 { return clock }
+	for i := 0; i <= layout.MaxSequence(); i++ {
+		if _, err := w.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// sequence is exhausted at the last timestamp, borrowing next millisecond overflows
+	clock = limit
+	if _, err := w.Next(); err == nil {
+		t.Fatal("timestamp should overflow")
+	}
+	if w.lastTimestamp != limit-1 || w.sequence != int32(layout.MaxSequence()) {
+		t.Fatalf("failed call should not change worker, timestamp %d sequence %d", w.lastTimestamp, w.sequence)
+	}
+}
+
+func TestAtomicWorker(t *testing.T) {
+	w, err := NewAtomicWorker(DefaultLayout, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const workers, each = 8, 20000
+	results := make(chan []int64, workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			var list []int64
+			for j := 0; j < each; j++ {
+				if i%2 == 0 {
+					id, err := w.Gen()
+					if err != nil {
+						t.Error(err)
+					}
+					list = append(list, id)
+				} else if j%100 == 0 {
+					ids, err := w.GenN(100)
+					if err != nil {
+						t.Error(err)
+					}
+					list = append(list, ids...)
+				}
+			}
+			results <- list
+		}(i)
+	}
+	seen := make(map[int64]bool)
+	for i := 0; i < workers; i++ {
+		list := <-results
+		for j, id := range list {
+			if seen[id] {
+				t.Fatalf("duplicate id %d", id)
+			}
+			if j > 0 && id <= list[j-1] {
+				t.Fatal("ids of a goroutine should be increasing")
+			}
+			if Decompose(id).Server != 3 {
+				t.Fatal("bad server id")
+			}
+			seen[id] = true
+		}
+	}
+	// sequence overflow borrows following milliseconds
+	clock := now()
+	w, _ = NewAtomicWorker(DefaultLayout, 0, 3)
+	w.clock = func() int64 { return clock }
+	ids, err := w.GenN(4096*3 + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := Decompose(ids[len(ids)-1]); p.Timestamp != clock+3 || p.Sequence != 0 {
+		t.Fatalf("bad last id %+v", p)
+	}
+	w.Borrow(0, 0)
+	if _, err := w.Gen(); err == nil {
+		t.Fatal("should not run ahead of clock")
+	}
+}
+
+func TestAtomicWorkerGenLarge(t *testing.T) {
+	w, _ := NewAtomicWorker(DefaultLayout, 0, 3)
+	n := 100000
+	ids, err := w.GenN(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != n {
+		t.Fatalf("should generate %d ids, got %d", n, len(ids))
+	}
+	for i := 1; i < n; i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatal("ids should be increasing")
+		}
+	}
+	if ahead := Decompose(ids[n-1]).Timestamp - now(); ahead > 10 {
+		t.Fatalf("ids should not run ahead of clock more than borrow, %dms", ahead)
+	}
+	if _, err := w.GenN(n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkGUIDParallel(b *testing.B) {
+	g := NewGUID(0, 4)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := g.Gen(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkAtomicParallel(b *testing.B) {
+	w, _ := NewAtomicWorker(DefaultLayout, 0, 0)
+	w.Borrow(time.Second, time.Second)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := w.Gen(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkAtomicGenN(b *testing.B) {
+	w, _ := NewAtomicWorker(DefaultLayout, 0, 0)
+	w.Borrow(time.Second, time.Second)
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1000 {
+		if _, err := w.GenN(1000); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package uid
+
+import (
+	"errors"
+	"time"
+)
+
+// KSUIDEpoch epoch of ksuid timestamp in unix seconds
+const KSUIDEpoch int64 = 1400000000
+
+// KSUID 32 bits timestamp(seconds since KSUIDEpoch) and 128 bits entropy, encoded into 27 chars base62
+type KSUID [20]byte
+
+var ksuidMonotonic = newMonotonic(128)
+
+// NewKSUID generate ksuid, ksuids are strictly increasing in process even within the same second
+func NewKSUID() KSUID {
+	sec, entropy := ksuidMonotonic.next(time.Now().Unix() - KSUIDEpoch)
+	var id KSUID
+	copy(id[:4], int64Bytes(sec)[4:])
+	copy(id[4:], entropy)
+	return id
+}
+
+// ParseKSUID parse ksuid string
+func ParseKSUID(s string) (KSUID, error) {
+	var id KSUID
+	b, err := decodeBase(s, &base62Decode, 62, 27, 20)
+	if err != nil {
+		return id, errors.New("invalid ksuid: " + err.Error())
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// ValidKSUID check ksuid string
+func ValidKSUID(s string) bool {
+	_, err := ParseKSUID(s)
+	return err == nil
+}
+
+// String canonical string
+func (id KSUID) String() string {
+	return encodeBase(id[:], base62Alphabet, 27)
+}
+
+// Time timestamp of ksuid
+func (id KSUID) Time() time.Time {
+	return time.Unix(bytesInt64(id[:4])+KSUIDEpoch, 0)
+}
@@ -0,0 +1,103 @@
+package uid
+
+import (
+	"fmt"
+	"time"
+)
+
+// Layout bit allocation of id, from high to low: timestamp(ms since Epoch) | datacenter | server | sequence,
+// sign bit is always 0 and timestamp takes the rest bits
+type Layout struct {
+	Epoch          int64 // ms
+	DatacenterBits uint8
+	ServerBits     uint8
+	SequenceBits   uint8
+}
+
+// DefaultLayout twitter snowflake layout used by InitGenerator
+var DefaultLayout = Layout{Epoch: Epoch, ServerBits: ServerBits, SequenceBits: SequenceBits}
+
+// minTimeBits 2^35ms is about 1 year
+const minTimeBits = 35
+
+// Parts decomposed id
+type Parts struct {
+	Timestamp  int64 // ms since unix epoch
+	Datacenter int
+	Server     int
+	Sequence   int
+}
+
+// Time timestamp as time
+func (p Parts) Time() time.Time {
+	return time.Unix(0, p.Timestamp*int64(time.Millisecond))
+}
+
+// Validate check bit allocation and epoch
+func (l Layout) Validate() error {
+	if l.SequenceBits == 0 || l.SequenceBits > 31 {
+		return fmt.Errorf("sequence bits should be in [1,31]")
+	}
+	if l.TimeBits() < minTimeBits {
+		return fmt.Errorf("too many bits allocated, only %d bits left for timestamp", l.TimeBits())
+	}
+	if l.Epoch < 0 || l.Epoch > now() {
+		return fmt.Errorf("epoch should be in the past")
+	}
+	return nil
+}
+
+// TimeBits bits of timestamp
+func (l Layout) TimeBits() int {
+	return 63 - int(l.DatacenterBits) - int(l.ServerBits) - int(l.SequenceBits)
+}
+
+// MaxDatacenter max datacenter id
+func (l Layout) MaxDatacenter() int {
+	return -1 ^ (-1 << l.DatacenterBits)
+}
+
+// MaxServer max server id
+func (l Layout) MaxServer() int {
+	return -1 ^ (-1 << l.ServerBits)
+}
+
+// MaxSequence max sequence in a millisecond
+func (l Layout) MaxSequence() int {
+	return -1 ^ (-1 << l.SequenceBits)
+}
+
+// Expire time when timestamp overflows
+func (l Layout) Expire() time.Time {
+	ms := l.Epoch + (1<<uint(l.TimeBits()) - 1)
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// Compose build id from parts, ts is ms since unix epoch
+func (l Layout) Compose(ts int64, datacenter, server, sequence int) int64 {
+	serverShift := l.SequenceBits
+	datacenterShift := serverShift + l.ServerBits
+	timeShift := datacenterShift + l.DatacenterBits
+	return (ts-l.Epoch)<<timeShift |
+		int64(datacenter&l.MaxDatacenter())<<datacenterShift |
+		int64(server&l.MaxServer())<<serverShift |
+		int64(sequence&l.MaxSequence())
+}
+
+// Decompose split id into parts
+func (l Layout) Decompose(id int64) Parts {
+	serverShift := l.SequenceBits
+	datacenterShift := serverShift + l.ServerBits
+	timeShift := datacenterShift + l.DatacenterBits
+	return Parts{
+		Timestamp:  id>>timeShift + l.Epoch,
+		Datacenter: int(id>>datacenterShift) & l.MaxDatacenter(),
+		Server:     int(id>>serverShift) & l.MaxServer(),
+		Sequence:   int(id) & l.MaxSequence(),
+	}
+}
+
+// Decompose split id generated by DefaultLayout
+func Decompose(id int64) Parts {
+	return DefaultLayout.Decompose(id)
+}
@@ -0,0 +1,292 @@
+package uid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/qjpcpu/common/redisutil"
+)
+
+// ErrLeaseLost worker id lease is lost, generator stops generating
+var ErrLeaseLost = errors.New("worker id lease lost")
+
+// Leaser lease unique worker id among instances, it also keeps the last timestamp(ms) of every id,
+// so that a new holder whose clock is behind doesn't generate ids the previous holder has generated
+type Leaser interface {
+	// Acquire claim a free id in [0,max], until is the max timestamp the holder may generate before next renew;
+	// it returns last timestamp of id kept by previous holders, 0 if none
+	Acquire(ctx context.Context, max int, until int64) (int, int64, error)
+	// Renew extend lease of id and keep until as last timestamp, return ErrLeaseLost if it's taken by others or expired
+	Renew(ctx context.Context, id int, until int64) error
+	// Release give up id, last is the last timestamp generated by holder
+	Release(ctx context.Context, id int, last int64) error
+	// TTL lease ttl
+	TTL() time.Duration
+}
+
+// LeaseGenerator generator whose server id is leased, it stops generating once lease is lost
+type LeaseGenerator struct {
+	leaser       Leaser
+	layout       Layout
+	datacenterId int
+	worker       *Worker
+	serverId     int
+	validUntil   time.Time
+	cancel       context.CancelFunc
+	done         chan struct{}
+	*sync.Mutex
+}
+
+// NewLeaseGenerator create generator of layout, server id is leased by leaser on Start
+func NewLeaseGenerator(leaser Leaser, layout Layout, datacenterId int) (*LeaseGenerator, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	if datacenterId < 0 || layout.MaxDatacenter() < datacenterId {
+		return nil, errors.New("invalid datacenter Id")
+	}
+	return &LeaseGenerator{
+		leaser:       leaser,
+		layout:       layout,
+		datacenterId: datacenterId,
+		serverId:     -1,
+		Mutex:        new(sync.Mutex),
+	}, nil
+}
+
+// Start acquire server id and keep renewing it in background; generating continues from the last timestamp
+// of previous holder, if clock of this instance is behind it, SkewTolerance decides to wait or fail
+func (g *LeaseGenerator) Start(ctx context.Context) error {
+	g.Lock()
+	defer g.Unlock()
+	if g.worker != nil {
+		return errors.New("already started")
+	}
+	validUntil := time.Now().Add(g.leaser.TTL())
+	id, last, err := g.leaser.Acquire(ctx, g.layout.MaxServer(), millis(validUntil))
+	if err != nil {
+		return err
+	}
+	worker, err := NewLayoutWorker(g.layout, g.datacenterId, id)
+	if err != nil {
+		g.leaser.Release(ctx, id, last)
+		return err
+	}
+	// ms of last timestamp may be used up by previous holder
+	worker.lastTimestamp, worker.sequence = last, int32(g.layout.MaxSequence())
+	g.worker, g.serverId = worker, id
+	g.validUntil = validUntil
+	rctx, cancel := context.WithCancel(context.Background())
+	g.cancel, g.done = cancel, make(chan struct{})
+	go g.renew(rctx, g.done)
+	return nil
+}
+
+// Stop stop renewing and release server id
+func (g *LeaseGenerator) Stop() {
+	g.Lock()
+	cancel, done, id := g.cancel, g.done, g.serverId
+	g.cancel = nil
+	g.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	g.Lock()
+	last := g.worker.lastTimestamp
+	g.worker, g.serverId, g.validUntil = nil, -1, time.Time{}
+	g.Unlock()
+	ctx, cancelRelease := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelRelease()
+	g.leaser.Release(ctx, id, last)
+}
+
+// ServerId leased server id, -1 if not started
+func (g *LeaseGenerator) ServerId() int {
+	g.Lock()
+	defer g.Unlock()
+	return g.serverId
+}
+
+// Gen generate id, return ErrLeaseLost if lease is lost or stopped
+func (g *LeaseGenerator) Gen() (int64, error) {
+	g.Lock()
+	defer g.Unlock()
+	if g.worker == nil {
+		return -1, errors.New("id generator not started")
+	}
+	if !time.Now().Before(g.validUntil) {
+		return -1, ErrLeaseLost
+	}
+	return g.worker.Next()
+}
+
+func (g *LeaseGenerator) renew(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ttl := g.leaser.TTL()
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		validUntil := time.Now().Add(ttl)
+		until := millis(validUntil)
+		g.Lock()
+		// logical clock may run ahead of system clock
+		if g.worker.lastTimestamp > until {
+			until = g.worker.lastTimestamp
+		}
+		g.Unlock()
+		err := g.leaser.Renew(ctx, g.serverId, until)
+		if err == ErrLeaseLost {
+			g.Lock()
+			g.validUntil = time.Time{}
+			g.Unlock()
+			return
+		}
+		// keep old deadline on transient error, generating stops once it passes
+		if err == nil {
+			g.Lock()
+			g.validUntil = validUntil
+			g.Unlock()
+		}
+	}
+}
+
+func (g *LeaseGenerator) setSkewTolerance(wait, max time.Duration) {
+	g.Lock()
+	defer g.Unlock()
+	if g.worker != nil {
+		g.worker.SkewTolerance(wait, max)
+	}
+}
+
+func (g *LeaseGenerator) skewStats() SkewStats {
+	g.Lock()
+	defer g.Unlock()
+	if g.worker == nil {
+		return SkewStats{}
+	}
+	return g.worker.SkewStats()
+}
+
+// InitLeaseGenerator use started lease generator as the generator of GenNumId and GenUniqueId
+func InitLeaseGenerator(g *LeaseGenerator) {
+	g_uid = g
+}
+
+// try ids from start, wrap around at max, return id and last timestamp of id
+// redis-cli --eval acquire.lua , prefix max start token ttl_ms until
+var acquireIdScript = redisutil.NewScript(0, `
+local max, start = tonumber(ARGV[2]), tonumber(ARGV[3])
+for i = 0, max do
+  local id = (start + i) % (max + 1)
+  if redis.call("SET", ARGV[1] .. id, ARGV[4], "NX", "PX", ARGV[5]) then
+    local lastKey = ARGV[1] .. id .. ":last"
+    local last = tonumber(redis.call("GET", lastKey) or 0)
+    if last < tonumber(ARGV[6]) then
+      redis.call("SET", lastKey, ARGV[6])
+    end
+    return {id, last}
+  end
+end
+return {-1, 0}
+`)
+
+// redis-cli --eval renew.lua key last_key , token ttl_ms until
+var renewIdScript = redisutil.NewScript(2, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  if tonumber(redis.call("GET", KEYS[2]) or 0) < tonumber(ARGV[3]) then
+    redis.call("SET", KEYS[2], ARGV[3])
+  end
+  return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// redis-cli --eval release.lua key last_key , token last
+var releaseIdScript = redisutil.NewScript(2, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  redis.call("SET", KEYS[2], ARGV[2])
+  return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type redisLeaser struct {
+	pool   *redisutil.Pool
+	prefix string
+	ttl    time.Duration
+	token  string
+}
+
+// NewRedisLeaser leaser backed by redis, id is held by key <prefix><id> with ttl, last timestamp of id is kept
+// by key <prefix><id>:last; keys are computed in script, so it doesn't work with redis cluster
+func NewRedisLeaser(pool *redisutil.Pool, prefix string, ttl time.Duration) Leaser {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return &redisLeaser{pool: pool, prefix: prefix, ttl: ttl, token: hex.EncodeToString(buf)}
+}
+
+func (l *redisLeaser) TTL() time.Duration {
+	return l.ttl
+}
+
+func (l *redisLeaser) Acquire(ctx context.Context, max int, until int64) (int, int64, error) {
+	conn, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return -1, 0, err
+	}
+	defer conn.Close()
+	// start from random id so that instances don't compete for the same id
+	start := int(now() % int64(max+1))
+	res, err := redisutil.Int64s(acquireIdScript.Do(conn, l.prefix, max, start, l.token, int64(l.ttl/time.Millisecond), until))
+	if err != nil {
+		return -1, 0, err
+	}
+	if len(res) != 2 || res[0] < 0 {
+		return -1, 0, errors.New("no free worker id")
+	}
+	return int(res[0]), res[1], nil
+}
+
+func (l *redisLeaser) Renew(ctx context.Context, id int, until int64) error {
+	conn, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	key := l.prefix + strconv.Itoa(id)
+	ok, err := redisutil.Bool(renewIdScript.Do(conn, key, key+":last", l.token, int64(l.ttl/time.Millisecond), until))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (l *redisLeaser) Release(ctx context.Context, id int, last int64) error {
+	conn, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	key := l.prefix + strconv.Itoa(id)
+	_, err = releaseIdScript.Do(conn, key, key+":last", l.token, last)
+	return err
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
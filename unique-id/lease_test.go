@@ -0,0 +1,100 @@
+package uid
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/qjpcpu/common/redisutil"
+)
+
+func TestRedisLeaser(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pool := redisutil.CreatePool(s.Addr(), "", "")
+	layout := Layout{Epoch: Epoch, ServerBits: 1, SequenceBits: 12}
+	var gens []*LeaseGenerator
+	ids := make(map[int]bool)
+	for i := 0; i < 2; i++ {
+		g, err := NewLeaseGenerator(NewRedisLeaser(pool, "uid:worker:", time.Second), layout, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		ids[g.ServerId()] = true
+		gens = append(gens, g)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("server ids should be unique %v", ids)
+	}
+	g, _ := NewLeaseGenerator(NewRedisLeaser(pool, "uid:worker:", time.Second), layout, 0)
+	if err := g.Start(context.Background()); err == nil {
+		t.Fatal("no free id left")
+	}
+	id, err := gens[0].Gen()
+	if err != nil || layout.Decompose(id).Server != gens[0].ServerId() {
+		t.Fatalf("bad id %v %v", id, err)
+	}
+	// lease taken by others
+	s.Set("uid:worker:"+strconv.Itoa(gens[0].ServerId()), "other")
+	deadline := time.Now().Add(3 * time.Second)
+	for _, err = gens[0].Gen(); err != ErrLeaseLost; _, err = gens[0].Gen() {
+		if time.Now().After(deadline) {
+			t.Fatal("generator should stop once lease lost")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// released id is free again
+	gens[1].Stop()
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if g.ServerId() != 1-gens[0].ServerId() {
+		t.Fatalf("should take released id, got %d", g.ServerId())
+	}
+	g.Stop()
+	gens[0].Stop()
+}
+
+func TestLeaseLastTimestamp(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pool := redisutil.CreatePool(s.Addr(), "", "")
+	layout := Layout{Epoch: Epoch, SequenceBits: 12}
+	// previous holder of id 0 generated ids ahead of clock of this instance
+	ahead := now() + 300
+	s.Set("uid:worker:0:last", strconv.FormatInt(ahead, 10))
+	g, _ := NewLeaseGenerator(NewRedisLeaser(pool, "uid:worker:", time.Second), layout, 0)
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if last, _ := s.Get("uid:worker:0:last"); last < strconv.FormatInt(ahead, 10) {
+		t.Fatalf("last timestamp should not go backwards %s", last)
+	}
+	if _, err := g.Gen(); err == nil {
+		t.Fatal("should not generate before clock catches up last timestamp")
+	}
+	g.setSkewTolerance(time.Second, 0)
+	id, err := g.Gen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := layout.Decompose(id).Timestamp
+	if ts <= ahead {
+		t.Fatalf("id of timestamp %d generated by previous holder", ts)
+	}
+	g.Stop()
+	if last, _ := s.Get("uid:worker:0:last"); last != strconv.FormatInt(ts, 10) {
+		t.Fatalf("release should keep last timestamp %d, got %s", ts, last)
+	}
+}
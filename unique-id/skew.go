@@ -0,0 +1,117 @@
+package uid
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// SkewStats counters of clock moving backwards
+type SkewStats struct {
+	Waited   uint64 // small skews waited out before generating
+	Logical  uint64 // ids generated by logical clock while system clock is behind
+	Rejected uint64 // ids failed by skew beyond tolerance
+	MaxSkew  int64  // max skew ever seen in ms
+}
+
+func (st *SkewStats) add(o SkewStats) {
+	st.Waited += o.Waited
+	st.Logical += o.Logical
+	st.Rejected += o.Rejected
+	if o.MaxSkew > st.MaxSkew {
+		st.MaxSkew = o.MaxSkew
+	}
+}
+
+// SkewTolerance set tolerance of clock moving backwards(e.g. NTP adjustment):
+// skew up to wait is waited out, skew up to max keeps generating ids by a logical clock which
+// continues from the last timestamp, error returns only if skew exceeds both; default is 0 that any skew is an error
+func (s *Worker) SkewTolerance(wait, max time.Duration) *Worker {
+	s.skewWait = int64(wait / time.Millisecond)
+	s.skewMax = int64(max / time.Millisecond)
+	return s
+}
+
+// SkewStats skew counters of worker
+func (s *Worker) SkewStats() SkewStats {
+	return SkewStats{
+		Waited:   atomic.LoadUint64(&s.skew.Waited),
+		Logical:  atomic.LoadUint64(&s.skew.Logical),
+		Rejected: atomic.LoadUint64(&s.skew.Rejected),
+		MaxSkew:  atomic.LoadInt64(&s.skew.MaxSkew),
+	}
+}
+
+// tolerate return timestamp to use when clock t is behind last timestamp
+func (s *Worker) tolerate(t int64) (int64, error) {
+	waited := false
+	for t < s.lastTimestamp {
+		skew := s.lastTimestamp - t
+		if skew > atomic.LoadInt64(&s.skew.MaxSkew) {
+			atomic.StoreInt64(&s.skew.MaxSkew, skew)
+		}
+		switch {
+		case skew <= s.skewWait:
+			if !waited {
+				waited = true
+				atomic.AddUint64(&s.skew.Waited, 1)
+			}
+			time.Sleep(time.Duration(skew) * time.Millisecond)
+			t = s.clock()
+		case skew <= s.skewMax:
+			atomic.AddUint64(&s.skew.Logical, 1)
+			return s.lastTimestamp, nil
+		default:
+			atomic.AddUint64(&s.skew.Rejected, 1)
+			return -1, fmt.Errorf("invalid system clock, moved backwards %dms", skew)
+		}
+	}
+	return t, nil
+}
+
+// SkewTolerance set skew tolerance of all workers, see Worker.SkewTolerance
+func (s *GUID) SkewTolerance(wait, max time.Duration) *GUID {
+	// hold all workers so that none is generating
+	held := make([]*Worker, 0, cap(s.workers))
+	for len(held) < cap(s.workers) {
+		held = append(held, <-s.workers)
+	}
+	for _, w := range held {
+		w.SkewTolerance(wait, max)
+		s.workers <- w
+	}
+	return s
+}
+
+// SkewStats skew counters of all workers, MaxSkew is the max of all
+func (s *GUID) SkewStats() SkewStats {
+	var st SkewStats
+	for _, w := range s.all {
+		st.add(w.SkewStats())
+	}
+	return st
+}
+
+// SetSkewTolerance set skew tolerance of generator initialized by InitGenerator or InitLeaseGenerator
+func SetSkewTolerance(wait, max time.Duration) error {
+	switch g := g_uid.(type) {
+	case *GUID:
+		g.SkewTolerance(wait, max)
+	case *LeaseGenerator:
+		g.setSkewTolerance(wait, max)
+	default:
+		return fmt.Errorf("id generator not initilized")
+	}
+	return nil
+}
+
+// GetSkewStats skew counters of generator initialized by InitGenerator or InitLeaseGenerator
+func GetSkewStats() SkewStats {
+	switch g := g_uid.(type) {
+	case *GUID:
+		return g.SkewStats()
+	case *LeaseGenerator:
+		return g.skewStats()
+	}
+	return SkewStats{}
+}
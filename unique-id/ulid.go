@@ -0,0 +1,48 @@
+package uid
+
+import (
+	"errors"
+	"time"
+)
+
+// ULID 48 bits unix ms timestamp and 80 bits entropy, encoded into 26 chars crockford base32
+type ULID [16]byte
+
+var ulidMonotonic = newMonotonic(80)
+
+// NewULID generate ulid, ulids are strictly increasing in process even within the same millisecond
+func NewULID() ULID {
+	ms, entropy := ulidMonotonic.next(now())
+	var id ULID
+	copy(id[:6], int64Bytes(ms)[2:])
+	copy(id[6:], entropy)
+	return id
+}
+
+// ParseULID parse ulid string, it's case insensitive
+func ParseULID(s string) (ULID, error) {
+	var id ULID
+	b, err := decodeBase(s, &base32Decode, 32, 26, 16)
+	if err != nil {
+		return id, errors.New("invalid ulid: " + err.Error())
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// ValidULID check ulid string
+func ValidULID(s string) bool {
+	_, err := ParseULID(s)
+	return err == nil
+}
+
+// String canonical string
+func (id ULID) String() string {
+	return encodeBase(id[:], base32Alphabet, 26)
+}
+
+// Time timestamp of ulid
+func (id ULID) Time() time.Time {
+	ms := bytesInt64(id[:6])
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
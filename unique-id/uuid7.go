@@ -0,0 +1,75 @@
+package uid
+
+import (
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// UUID uuid bytes
+type UUID [16]byte
+
+// 12 bits rand_a and 62 bits rand_b
+var uuidMonotonic = newMonotonic(74)
+
+// NewUUIDv7 generate uuid version 7: 48 bits unix ms timestamp, version, 12 bits rand_a, variant, 62 bits rand_b;
+// uuids are strictly increasing in process even within the same millisecond
+func NewUUIDv7() UUID {
+	ms, entropy := uuidMonotonic.next(now())
+	hi := uint64(entropy[0])<<8 | uint64(entropy[1])
+	lo := uint64(bytesInt64(entropy[2:]))
+	randA := hi<<2 | lo>>62
+	randB := lo & (1<<62 - 1)
+	var id UUID
+	copy(id[:8], int64Bytes(int64(uint64(ms)<<16|0x7<<12|randA)))
+	copy(id[8:], int64Bytes(int64(0x2<<62|randB)))
+	return id
+}
+
+// ParseUUIDv7 parse uuid string of version 7
+func ParseUUIDv7(s string) (UUID, error) {
+	var id UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return id, errors.New("invalid uuid format")
+	}
+	src := s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(id[:], []byte(src)); err != nil {
+		return id, errors.New("invalid uuid: " + err.Error())
+	}
+	if id.Version() != 7 || id[8]&0xc0 != 0x80 {
+		return id, errors.New("not uuid version 7")
+	}
+	return id, nil
+}
+
+// ValidUUIDv7 check uuid string of version 7
+func ValidUUIDv7(s string) bool {
+	_, err := ParseUUIDv7(s)
+	return err == nil
+}
+
+// Version uuid version
+func (id UUID) Version() int {
+	return int(id[6] >> 4)
+}
+
+// String canonical string xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func (id UUID) String() string {
+	buf := make([]byte, 36)
+	hex.Encode(buf, id[:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return string(buf)
+}
+
+// Time timestamp of uuid version 7
+func (id UUID) Time() time.Time {
+	ms := bytesInt64(id[:6])
+	return time.Unix(0, ms*int64(time.Millisecond))
+}